@@ -10,7 +10,10 @@ import (
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/bibendi/gruf-relay/internal/admin"
+	"github.com/bibendi/gruf-relay/internal/autoscale"
 	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/healthcheck"
 	"github.com/bibendi/gruf-relay/internal/loadbalance"
@@ -20,6 +23,7 @@ import (
 	"github.com/bibendi/gruf-relay/internal/probes"
 	"github.com/bibendi/gruf-relay/internal/proxy"
 	"github.com/bibendi/gruf-relay/internal/server"
+	"github.com/bibendi/gruf-relay/internal/worker"
 )
 
 var (
@@ -47,40 +51,74 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 
-	// Initialize readiness probe
+	// Initialize startup and readiness probes
 	isStarted := &atomic.Value{}
 	isStarted.Store(false)
+	isStopping := &atomic.Value{}
+	isStopping.Store(false)
 
-	// Run Worker Manager
-	m := manager.NewManager(cfg.Workers)
+	// Reap orphaned worker processes when running as the init process of a container
+	if os.Getpid() == 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.RunReaper(ctx)
+		}()
+	}
+
+	// Worker state transitions are logged, exported as metrics and followed by the balancer and probes
+	events := worker.NewEventBus()
+	events.Subscribe(worker.LogEvent)
+	events.Subscribe(worker.RecordEvent)
+
+	// Run Load Balancer
+	lb := loadbalance.NewLoadBalancer(cfg.Server.Queue)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := m.Run(ctx); err != nil {
-			log.Error("Failed to start servers", slog.Any("error", err))
-			cancel()
-		}
+		lb.Run(ctx)
 	}()
+	events.Subscribe(lb.HandleEvent)
 
-	// Run Load Balancer
-	lb := loadbalance.NewLoadBalancer()
+	// Run Worker Manager
+	m, err := manager.NewManager(cfg.Workers, events, cfg.RelayPorts())
+	if err != nil {
+		log.Error("Failed to create workers", slog.Any("error", err))
+		cancel()
+		wg.Wait()
+		os.Exit(1)
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		lb.Run(ctx)
+		if err := m.Run(ctx); err != nil {
+			log.Error("Failed to start servers", slog.Any("error", err))
+			cancel()
+		}
 	}()
 
 	// Run Health Checker
-	hc := healthcheck.NewChecker(cfg.HealthCheck, m.GetWorkers(), lb, nil)
+	hc := healthcheck.NewChecker(cfg.HealthCheck, m, nil)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		hc.Run(ctx)
 	}()
 
+	// Run autoscaler
+	if cfg.Workers.Autoscale.Enabled {
+		autoscaler := autoscale.NewAutoscaler(cfg.Workers, m, lb)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			autoscaler.Run(ctx)
+		}()
+	}
+
 	// Run probes
 	if cfg.Probes.Enabled {
-		probes := probes.NewProbes(cfg.Probes, isStarted, m, hc)
+		probes := probes.NewProbes(cfg.Probes, isStarted, isStopping, m)
+		events.Subscribe(probes.HandleEvent)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -91,6 +129,19 @@ func main() {
 		}()
 	}
 
+	// Run admin server
+	if cfg.Admin.Enabled {
+		adminServer := admin.NewServer(cfg.Admin, m, hc, lb)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := adminServer.Serve(ctx); err != nil {
+				log.Error("Failed to serve admin API", slog.Any("error", err))
+				cancel()
+			}
+		}()
+	}
+
 	// Run metrics
 	if cfg.Metrics.Enabled {
 		metrics := metrics.NewScraper(cfg.Metrics, m)
@@ -104,13 +155,15 @@ func main() {
 		}()
 	}
 
-	// Run gRPC server
-	grpcProxy := proxy.NewProxy(lb, cfg.Server.ProxyTimeout)
+	// Run gRPC server. It is stopped on its own, so that in-flight requests
+	// are drained while the workers serving them are still running.
+	grpcProxy := proxy.NewProxy(lb, cfg.Server)
 	grpcServer := server.NewServer(cfg.Server, grpcProxy)
-	wg.Add(1)
+	serverCtx, stopServer := context.WithCancel(ctx)
+	serverDone := make(chan struct{})
 	go func() {
-		defer wg.Done()
-		if err := grpcServer.Serve(ctx); err != nil {
+		defer close(serverDone)
+		if err := grpcServer.Serve(serverCtx); err != nil {
 			log.Error("Failed to serve gRPC requests", slog.Any("error", err))
 			cancel()
 		}
@@ -122,16 +175,75 @@ func main() {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	restartCh := make(chan os.Signal, 1)
+	signal.Notify(restartCh, syscall.SIGUSR2)
+
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+
+	scaleCh := make(chan os.Signal, 1)
+	signal.Notify(scaleCh, syscall.SIGTTIN, syscall.SIGTTOU)
+
 	exitCode := 0
-	select {
-	case <-ctx.Done():
-		log.Error("Shutdown initiated by context", slog.Any("error", ctx.Err()))
-		exitCode = 1
-	case sig := <-signalCh:
-		log.Info("Received termination signal, initiating graceful shutdown...", slog.Any("signal", sig))
-		cancel()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			log.Error("Shutdown initiated by context", slog.Any("error", ctx.Err()))
+			exitCode = 1
+			break loop
+		case sig := <-signalCh:
+			log.Info("Received termination signal, initiating graceful shutdown...", slog.Any("signal", sig))
+			break loop
+		case sig := <-restartCh:
+			log.Info("Received rolling restart signal", slog.Any("signal", sig))
+			go func() {
+				if err := m.RollingRestart(ctx, hc); err != nil {
+					log.Error("Rolling restart failed", slog.Any("error", err))
+				}
+			}()
+		case sig := <-reloadCh:
+			log.Info("Received reload signal", slog.Any("signal", sig))
+			go func() {
+				if err := m.Reload(ctx, hc, lb); err != nil {
+					log.Error("Reload failed", slog.Any("error", err))
+				}
+			}()
+		case sig := <-scaleCh:
+			log.Info("Received scaling signal", slog.Any("signal", sig))
+			go func() {
+				var err error
+				if sig == syscall.SIGTTIN {
+					_, err = m.ScaleUp()
+				} else {
+					_, err = m.ScaleDown(ctx)
+				}
+				if err != nil {
+					log.Error("Scaling failed", slog.Any("signal", sig), slog.Any("error", err))
+				}
+			}()
+		}
+	}
+
+	if exitCode == 0 {
+		// Fail readiness first and give Kubernetes time to remove the pod from service endpoints
+		isStopping.Store(true)
+		log.Info("Waiting before stopping gRPC server", slog.Duration("delay", cfg.Server.ShutdownDelay))
+		select {
+		case <-time.After(cfg.Server.ShutdownDelay):
+		case sig := <-signalCh:
+			log.Info("Received another termination signal, skipping shutdown delay", slog.Any("signal", sig))
+		case <-ctx.Done():
+		}
 	}
 
+	// Stop accepting new requests and drain in-flight ones
+	stopServer()
+	<-serverDone
+
+	// Only then drain and stop workers along with the probes, metrics and admin servers
+	log.Info("Stopping workers")
+	cancel()
 	wg.Wait()
 
 	log.Info("Goodbye!")
@@ -1,6 +1,7 @@
 # frozen_string_literal: true
 
 require_relative "gruf_relay/version"
+require_relative "gruf_relay/notify"
 
 module GrufRelay
   class Error < StandardError; end
@@ -0,0 +1,52 @@
+# frozen_string_literal: true
+
+require "gruf"
+require_relative "notify"
+
+module GrufRelay
+  # Gruf hook that notifies gruf-relay once the gRPC server accepts requests
+  # and as soon as it starts shutting down, before in-flight requests have
+  # finished. Pings the relay watchdog every watchdog_interval seconds when
+  # the option is given.
+  #
+  #   Gruf.configure do |c|
+  #     c.hooks.use(GrufRelay::GrufHook, watchdog_interval: 5)
+  #   end
+  class GrufHook < ::Gruf::Hooks::Base
+    DEFAULT_BOOT_TIMEOUT = 60 # sec
+    # Gruf has no hook before the server stops, so the server state is polled.
+    STOP_POLL_INTERVAL = 0.1 # sec
+
+    def before_server_start(server:)
+      return unless Notify.enabled?
+
+      Thread.new do
+        rpc_server = server.server
+        next unless rpc_server.wait_till_running(options.fetch(:boot_timeout, DEFAULT_BOOT_TIMEOUT))
+
+        Notify.ready!
+        watch(rpc_server)
+        Notify.stopping!
+      end
+    end
+
+    private
+
+    # Returns once the server leaves the running state, which it does when its
+    # shutdown begins. Pings the watchdog meanwhile.
+    def watch(rpc_server)
+      next_ping = monotonic_now
+      while rpc_server.running?
+        if options[:watchdog_interval] && monotonic_now >= next_ping
+          Notify.watchdog!
+          next_ping = monotonic_now + options[:watchdog_interval]
+        end
+        sleep(STOP_POLL_INTERVAL)
+      end
+    end
+
+    def monotonic_now
+      Process.clock_gettime(Process::CLOCK_MONOTONIC)
+    end
+  end
+end
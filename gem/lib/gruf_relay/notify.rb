@@ -0,0 +1,50 @@
+# frozen_string_literal: true
+
+require "socket"
+
+module GrufRelay
+  # Notifies gruf-relay about the state of the worker over the socket
+  # passed in NOTIFY_SOCKET. Does nothing when the socket is not set.
+  module Notify
+    class << self
+      def enabled?
+        !socket_path.to_s.empty?
+      end
+
+      # The worker has booted and can receive requests.
+      def ready!
+        notify("READY=1")
+      end
+
+      # The worker is going to exit and must not receive requests anymore.
+      def stopping!
+        notify("STOPPING=1")
+      end
+
+      # Free-form status shown in the relay logs and admin API.
+      def status(text)
+        notify("STATUS=#{text}")
+      end
+
+      # Keeps the relay watchdog from marking the worker unhealthy.
+      def watchdog!
+        notify("WATCHDOG=1")
+      end
+
+      def notify(*messages)
+        return false unless enabled?
+
+        Socket.open(:UNIX, :DGRAM) do |socket|
+          socket.send(messages.join("\n"), 0, Socket.sockaddr_un(socket_path))
+        end
+        true
+      end
+
+      private
+
+      def socket_path
+        ENV["NOTIFY_SOCKET"]
+      end
+    end
+  end
+end
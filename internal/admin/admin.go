@@ -0,0 +1,167 @@
+//go:generate mockgen -source=admin.go -destination=admin_mock.go -package=admin
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/log"
+	"github.com/bibendi/gruf-relay/internal/manager"
+	"github.com/bibendi/gruf-relay/internal/worker"
+)
+
+type Manager interface {
+	RollingRestart(ctx context.Context, hc manager.HealthChecker) error
+	Reload(ctx context.Context, hc manager.HealthChecker, lb manager.Balancer) error
+	ScaleUp() (int, error)
+	ScaleDown(ctx context.Context) (int, error)
+	ListWorkers() []manager.WorkerInfo
+	CrashReports() []worker.CrashReport
+}
+
+type Server struct {
+	host string
+	port int
+	m    Manager
+	hc   manager.HealthChecker
+	lb   manager.Balancer
+}
+
+func NewServer(cfg config.Admin, m Manager, hc manager.HealthChecker, lb manager.Balancer) *Server {
+	return &Server{
+		host: cfg.Host,
+		port: cfg.Port,
+		m:    m,
+		hc:   hc,
+		lb:   lb,
+	}
+}
+
+func (s *Server) Serve(ctx context.Context) error {
+	log.Info("Starting admin server", slog.String("host", s.host), slog.Int("port", s.port))
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(s.host, fmt.Sprint(s.port)),
+		Handler: s.handler(),
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	errChan := make(chan error, 1)
+	defer close(errChan)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			if err != http.ErrServerClosed {
+				log.Error("Admin server failed", slog.Any("error", err))
+				errChan <- err
+			}
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		log.Info("Stopping admin server")
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Error("Failed to shutdown admin server", slog.Any("error", err))
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /restart", s.handleRestart)
+	mux.HandleFunc("POST /reload", s.handleReload)
+	mux.HandleFunc("GET /workers", s.handleWorkers)
+	mux.HandleFunc("GET /workers/crashes", s.handleCrashes)
+	mux.HandleFunc("POST /workers/scale_up", s.handleScaleUp)
+	mux.HandleFunc("POST /workers/scale_down", s.handleScaleDown)
+	return mux
+}
+
+// handleRestart performs a rolling restart of all workers and responds once it is finished.
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received rolling restart request")
+	err := s.m.RollingRestart(r.Context(), s.hc)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, manager.ErrRollingRestartInProgress), errors.Is(err, manager.ErrReloadInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Error("Rolling restart failed", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleReload swaps in a new generation of workers and responds once the old one is stopped.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received reload request")
+	err := s.m.Reload(r.Context(), s.hc, s.lb)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, manager.ErrReloadInProgress), errors.Is(err, manager.ErrRollingRestartInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, manager.ErrNotRunning):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		log.Error("Reload failed", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleWorkers responds with the workers and the ports they were given.
+func (s *Server) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.m.ListWorkers()); err != nil {
+		log.Error("Failed to write workers", slog.Any("error", err))
+	}
+}
+
+// handleCrashes responds with the last crash reports of the workers, latest first.
+func (s *Server) handleCrashes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.m.CrashReports()); err != nil {
+		log.Error("Failed to write crash reports", slog.Any("error", err))
+	}
+}
+
+// handleScaleUp adds a worker and responds with the new number of workers.
+func (s *Server) handleScaleUp(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received scale up request")
+	count, err := s.m.ScaleUp()
+	s.writeScaleResult(w, count, err)
+}
+
+// handleScaleDown drains and removes a worker and responds with the new number of workers.
+func (s *Server) handleScaleDown(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received scale down request")
+	count, err := s.m.ScaleDown(r.Context())
+	s.writeScaleResult(w, count, err)
+}
+
+func (s *Server) writeScaleResult(w http.ResponseWriter, count int, err error) {
+	switch {
+	case err == nil:
+		fmt.Fprintln(w, count)
+	case errors.Is(err, manager.ErrMinWorkers), errors.Is(err, manager.ErrMaxWorkers), errors.Is(err, manager.ErrNoFreePorts):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, manager.ErrNotRunning):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		log.Error("Scaling failed", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
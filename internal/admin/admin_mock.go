@@ -0,0 +1,129 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: admin.go
+//
+// Generated by this command:
+//
+//	mockgen -source=admin.go -destination=admin_mock.go -package=admin
+//
+
+// Package admin is a generated GoMock package.
+package admin
+
+import (
+	context "context"
+	reflect "reflect"
+
+	manager "github.com/bibendi/gruf-relay/internal/manager"
+	worker "github.com/bibendi/gruf-relay/internal/worker"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockManager is a mock of Manager interface.
+type MockManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockManagerMockRecorder
+	isgomock struct{}
+}
+
+// MockManagerMockRecorder is the mock recorder for MockManager.
+type MockManagerMockRecorder struct {
+	mock *MockManager
+}
+
+// NewMockManager creates a new mock instance.
+func NewMockManager(ctrl *gomock.Controller) *MockManager {
+	mock := &MockManager{ctrl: ctrl}
+	mock.recorder = &MockManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockManager) EXPECT() *MockManagerMockRecorder {
+	return m.recorder
+}
+
+// CrashReports mocks base method.
+func (m *MockManager) CrashReports() []worker.CrashReport {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CrashReports")
+	ret0, _ := ret[0].([]worker.CrashReport)
+	return ret0
+}
+
+// CrashReports indicates an expected call of CrashReports.
+func (mr *MockManagerMockRecorder) CrashReports() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CrashReports", reflect.TypeOf((*MockManager)(nil).CrashReports))
+}
+
+// ListWorkers mocks base method.
+func (m *MockManager) ListWorkers() []manager.WorkerInfo {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWorkers")
+	ret0, _ := ret[0].([]manager.WorkerInfo)
+	return ret0
+}
+
+// ListWorkers indicates an expected call of ListWorkers.
+func (mr *MockManagerMockRecorder) ListWorkers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWorkers", reflect.TypeOf((*MockManager)(nil).ListWorkers))
+}
+
+// Reload mocks base method.
+func (m *MockManager) Reload(ctx context.Context, hc manager.HealthChecker, lb manager.Balancer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reload", ctx, hc, lb)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reload indicates an expected call of Reload.
+func (mr *MockManagerMockRecorder) Reload(ctx, hc, lb any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reload", reflect.TypeOf((*MockManager)(nil).Reload), ctx, hc, lb)
+}
+
+// RollingRestart mocks base method.
+func (m *MockManager) RollingRestart(ctx context.Context, hc manager.HealthChecker) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RollingRestart", ctx, hc)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollingRestart indicates an expected call of RollingRestart.
+func (mr *MockManagerMockRecorder) RollingRestart(ctx, hc any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollingRestart", reflect.TypeOf((*MockManager)(nil).RollingRestart), ctx, hc)
+}
+
+// ScaleDown mocks base method.
+func (m *MockManager) ScaleDown(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScaleDown", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScaleDown indicates an expected call of ScaleDown.
+func (mr *MockManagerMockRecorder) ScaleDown(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScaleDown", reflect.TypeOf((*MockManager)(nil).ScaleDown), ctx)
+}
+
+// ScaleUp mocks base method.
+func (m *MockManager) ScaleUp() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScaleUp")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScaleUp indicates an expected call of ScaleUp.
+func (mr *MockManagerMockRecorder) ScaleUp() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScaleUp", reflect.TypeOf((*MockManager)(nil).ScaleUp))
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/manager"
+	"github.com/bibendi/gruf-relay/internal/worker"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAdmin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Admin Suite")
+}
+
+var _ = Describe("Admin", func() {
+	var (
+		ctrl *gomock.Controller
+		m    *MockManager
+		hc   *manager.MockHealthChecker
+		lb   *manager.MockBalancer
+		srv  *Server
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		m = NewMockManager(ctrl)
+		hc = manager.NewMockHealthChecker(ctrl)
+		lb = manager.NewMockBalancer(ctrl)
+		srv = NewServer(config.Admin{Host: "127.0.0.1", Port: 8081}, m, hc, lb)
+
+		DeferCleanup(func() {
+			ctrl.Finish()
+		})
+	})
+
+	Describe("Serve", func() {
+		It("should stop serving on context done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-time.After(100 * time.Millisecond)
+				cancel()
+			}()
+			Expect(srv.Serve(ctx)).To(Succeed())
+		})
+
+		It("returns error when cannot serve", func() {
+			srv = NewServer(config.Admin{Host: "127.0.0.1", Port: 99999999}, m, hc, lb)
+			Expect(srv.Serve(context.Background())).To(HaveOccurred())
+		})
+	})
+
+	Describe("POST /reload", func() {
+		reload := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+			return rec
+		}
+
+		It("responds with 200 when the new generation is swapped in", func() {
+			m.EXPECT().Reload(gomock.Any(), hc, lb).Return(nil)
+			Expect(reload().Code).To(Equal(http.StatusOK))
+		})
+
+		It("responds with 409 when a reload is already in progress", func() {
+			m.EXPECT().Reload(gomock.Any(), hc, lb).Return(manager.ErrReloadInProgress)
+			Expect(reload().Code).To(Equal(http.StatusConflict))
+		})
+
+		It("responds with 409 during a rolling restart", func() {
+			m.EXPECT().Reload(gomock.Any(), hc, lb).Return(manager.ErrRollingRestartInProgress)
+			rec := reload()
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+			Expect(rec.Body.String()).To(ContainSubstring("rolling restart is already in progress"))
+		})
+
+		It("responds with 500 when the new generation does not become ready", func() {
+			m.EXPECT().Reload(gomock.Any(), hc, lb).Return(errors.New("worker did not become ready"))
+			Expect(reload().Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Describe("POST /restart", func() {
+		restart := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/restart", nil))
+			return rec
+		}
+
+		It("responds with 200 when rolling restart succeeds", func() {
+			m.EXPECT().RollingRestart(gomock.Any(), hc).Return(nil)
+			Expect(restart().Code).To(Equal(http.StatusOK))
+		})
+
+		It("responds with 409 when rolling restart is already in progress", func() {
+			m.EXPECT().RollingRestart(gomock.Any(), hc).Return(manager.ErrRollingRestartInProgress)
+			Expect(restart().Code).To(Equal(http.StatusConflict))
+		})
+
+		It("responds with 409 during a reload", func() {
+			m.EXPECT().RollingRestart(gomock.Any(), hc).Return(manager.ErrReloadInProgress)
+			rec := restart()
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+			Expect(rec.Body.String()).To(ContainSubstring("reload is already in progress"))
+		})
+
+		It("responds with 500 when rolling restart fails", func() {
+			m.EXPECT().RollingRestart(gomock.Any(), hc).Return(errors.New("worker did not become ready"))
+			Expect(restart().Code).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("rejects other methods", func() {
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/restart", nil))
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Describe("GET /workers", func() {
+		It("responds with the workers and their ports", func() {
+			m.EXPECT().ListWorkers().Return([]manager.WorkerInfo{
+				{Name: "worker-1", Index: 0, Addr: "0.0.0.0:9000", Port: 9000, MetricsPort: 9100, Running: true, State: "ready", Restarts: 2},
+			})
+
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/workers", nil))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`[{"name":"worker-1","index":0,"addr":"0.0.0.0:9000","port":9000,"metrics_port":9100,"running":true,"state":"ready","restarts":2}]`))
+		})
+	})
+
+	Describe("GET /workers/crashes", func() {
+		It("responds with the crash reports of the workers", func() {
+			exitedAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+			m.EXPECT().CrashReports().Return([]worker.CrashReport{
+				{Worker: "worker-1", PID: 42, Reason: worker.ExitReasonOOM, ExitCode: -1, Signal: "killed", StartedAt: exitedAt.Add(-time.Minute), ExitedAt: exitedAt, Restarts: 1,
+					Output: []worker.OutputLine{{Stream: "stderr", Text: "Killed"}}},
+			})
+
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/workers/crashes", nil))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`[{"worker":"worker-1","pid":42,"reason":"oom","exit_code":-1,"signal":"killed",
+				"started_at":"2025-05-01T11:59:00Z","exited_at":"2025-05-01T12:00:00Z","restarts":1,
+				"output":[{"stream":"stderr","text":"Killed"}]}]`))
+		})
+	})
+
+	Describe("POST /workers/scale_up", func() {
+		scaleUp := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/workers/scale_up", nil))
+			return rec
+		}
+
+		It("responds with the new number of workers", func() {
+			m.EXPECT().ScaleUp().Return(3, nil)
+			rec := scaleUp()
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(Equal("3\n"))
+		})
+
+		It("responds with 409 when there are no free ports", func() {
+			m.EXPECT().ScaleUp().Return(100, manager.ErrMaxWorkers)
+			Expect(scaleUp().Code).To(Equal(http.StatusConflict))
+		})
+
+		It("responds with 503 when the manager is not running", func() {
+			m.EXPECT().ScaleUp().Return(0, manager.ErrNotRunning)
+			Expect(scaleUp().Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Describe("POST /workers/scale_down", func() {
+		scaleDown := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/workers/scale_down", nil))
+			return rec
+		}
+
+		It("responds with the new number of workers", func() {
+			m.EXPECT().ScaleDown(gomock.Any()).Return(1, nil)
+			rec := scaleDown()
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(Equal("1\n"))
+		})
+
+		It("responds with 409 when removing the last worker", func() {
+			m.EXPECT().ScaleDown(gomock.Any()).Return(1, manager.ErrMinWorkers)
+			Expect(scaleDown().Code).To(Equal(http.StatusConflict))
+		})
+	})
+})
@@ -0,0 +1,179 @@
+//go:generate mockgen -source=autoscale.go -destination=autoscale_mock.go -package=autoscale
+package autoscale
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/loadbalance"
+	"github.com/bibendi/gruf-relay/internal/log"
+	"github.com/bibendi/gruf-relay/internal/worker"
+)
+
+type Manager interface {
+	GetWorkers() map[string]worker.Worker
+	ScaleUp() (int, error)
+	ScaleDown(ctx context.Context) (int, error)
+}
+
+type Balancer interface {
+	QueueStats() loadbalance.QueueStats
+}
+
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+type Autoscaler struct {
+	m            Manager
+	lb           Balancer
+	min          int
+	max          int
+	interval     time.Duration
+	upUtil       float64
+	downUtil     float64
+	upWait       time.Duration
+	upCooldown   time.Duration
+	downCooldown time.Duration
+	lastScale    time.Time
+	prevQueue    loadbalance.QueueStats
+}
+
+// sample is the load of all workers observed during one interval.
+type sample struct {
+	workers    int
+	inUse      int
+	capacity   int
+	dispatched int64
+	waitTime   time.Duration
+}
+
+func NewAutoscaler(cfg config.Workers, m Manager, lb Balancer) *Autoscaler {
+	return &Autoscaler{
+		m:            m,
+		lb:           lb,
+		min:          cfg.Min,
+		max:          cfg.Max,
+		interval:     cfg.Autoscale.Interval,
+		upUtil:       cfg.Autoscale.ScaleUpUtilization,
+		downUtil:     cfg.Autoscale.ScaleDownUtilization,
+		upWait:       cfg.Autoscale.ScaleUpWait,
+		upCooldown:   cfg.Autoscale.ScaleUpCooldown,
+		downCooldown: cfg.Autoscale.ScaleDownCooldown,
+		lastScale:    time.Now(),
+	}
+}
+
+func (a *Autoscaler) Run(ctx context.Context) {
+	log.Info("Starting autoscaler", slog.Int("min", a.min), slog.Int("max", a.max))
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping autoscaler")
+			return
+		case <-ticker.C:
+			a.scale(ctx)
+		}
+	}
+}
+
+func (a *Autoscaler) scale(ctx context.Context) {
+	s := a.sample()
+	poolUtilization.Set(s.utilization())
+	connectionWait.Set(s.averageWait().Seconds())
+
+	direction := a.decide(s, time.Now())
+	if direction == "" {
+		return
+	}
+
+	attrs := []any{
+		slog.String("direction", direction),
+		slog.Int("workers_count", s.workers),
+		slog.Float64("utilization", s.utilization()),
+		slog.Duration("average_wait", s.averageWait()),
+	}
+	log.Info("Autoscaling workers", attrs...)
+
+	var err error
+	if direction == DirectionUp {
+		_, err = a.m.ScaleUp()
+	} else {
+		_, err = a.m.ScaleDown(ctx)
+	}
+	// The cooldown also applies to failed attempts, so a failing scale up is not retried every interval.
+	a.lastScale = time.Now()
+	if err != nil {
+		log.Error("Autoscaling failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	decisionsTotal.WithLabelValues(direction).Inc()
+}
+
+// sample collects the pool usage of all active workers, and the time requests
+// waited in the queue for a free connection since the previous sample.
+func (a *Autoscaler) sample() sample {
+	s := sample{}
+	for _, w := range a.m.GetWorkers() {
+		// Spares take no requests and are not scaled.
+		if w.Status().Spare {
+			continue
+		}
+
+		st := w.PoolStats()
+		s.workers++
+		s.inUse += st.InUse
+		s.capacity += st.Size
+	}
+
+	queue := a.lb.QueueStats()
+	s.dispatched = queue.Dispatched - a.prevQueue.Dispatched
+	s.waitTime = queue.WaitTime - a.prevQueue.WaitTime
+	a.prevQueue = queue
+	return s
+}
+
+// decide returns the scaling direction for the sample, or an empty string to keep the workers.
+// Scaling down requires the remaining workers to stay below the scale up threshold, so that
+// the autoscaler does not flap between two sizes.
+func (a *Autoscaler) decide(s sample, now time.Time) string {
+	if s.workers == 0 || s.capacity == 0 {
+		return ""
+	}
+
+	since := now.Sub(a.lastScale)
+	saturated := s.utilization() >= a.upUtil || (a.upWait > 0 && s.averageWait() >= a.upWait)
+
+	switch {
+	case saturated:
+		if s.workers < a.max && since >= a.upCooldown {
+			return DirectionUp
+		}
+	case s.utilization() <= a.downUtil:
+		remaining := s.capacity - s.capacity/s.workers
+		if s.workers > a.min && since >= a.downCooldown && float64(s.inUse) < a.upUtil*float64(remaining) {
+			return DirectionDown
+		}
+	}
+	return ""
+}
+
+func (s sample) utilization() float64 {
+	if s.capacity == 0 {
+		return 0
+	}
+	return float64(s.inUse) / float64(s.capacity)
+}
+
+func (s sample) averageWait() time.Duration {
+	if s.dispatched == 0 {
+		return 0
+	}
+	return s.waitTime / time.Duration(s.dispatched)
+}
@@ -0,0 +1,125 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: autoscale.go
+//
+// Generated by this command:
+//
+//	mockgen -source=autoscale.go -destination=autoscale_mock.go -package=autoscale
+//
+
+// Package autoscale is a generated GoMock package.
+package autoscale
+
+import (
+	context "context"
+	reflect "reflect"
+
+	loadbalance "github.com/bibendi/gruf-relay/internal/loadbalance"
+	worker "github.com/bibendi/gruf-relay/internal/worker"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockManager is a mock of Manager interface.
+type MockManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockManagerMockRecorder
+	isgomock struct{}
+}
+
+// MockManagerMockRecorder is the mock recorder for MockManager.
+type MockManagerMockRecorder struct {
+	mock *MockManager
+}
+
+// NewMockManager creates a new mock instance.
+func NewMockManager(ctrl *gomock.Controller) *MockManager {
+	mock := &MockManager{ctrl: ctrl}
+	mock.recorder = &MockManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockManager) EXPECT() *MockManagerMockRecorder {
+	return m.recorder
+}
+
+// GetWorkers mocks base method.
+func (m *MockManager) GetWorkers() map[string]worker.Worker {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkers")
+	ret0, _ := ret[0].(map[string]worker.Worker)
+	return ret0
+}
+
+// GetWorkers indicates an expected call of GetWorkers.
+func (mr *MockManagerMockRecorder) GetWorkers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkers", reflect.TypeOf((*MockManager)(nil).GetWorkers))
+}
+
+// ScaleDown mocks base method.
+func (m *MockManager) ScaleDown(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScaleDown", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScaleDown indicates an expected call of ScaleDown.
+func (mr *MockManagerMockRecorder) ScaleDown(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScaleDown", reflect.TypeOf((*MockManager)(nil).ScaleDown), ctx)
+}
+
+// ScaleUp mocks base method.
+func (m *MockManager) ScaleUp() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScaleUp")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScaleUp indicates an expected call of ScaleUp.
+func (mr *MockManagerMockRecorder) ScaleUp() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScaleUp", reflect.TypeOf((*MockManager)(nil).ScaleUp))
+}
+
+// MockBalancer is a mock of Balancer interface.
+type MockBalancer struct {
+	ctrl     *gomock.Controller
+	recorder *MockBalancerMockRecorder
+	isgomock struct{}
+}
+
+// MockBalancerMockRecorder is the mock recorder for MockBalancer.
+type MockBalancerMockRecorder struct {
+	mock *MockBalancer
+}
+
+// NewMockBalancer creates a new mock instance.
+func NewMockBalancer(ctrl *gomock.Controller) *MockBalancer {
+	mock := &MockBalancer{ctrl: ctrl}
+	mock.recorder = &MockBalancerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBalancer) EXPECT() *MockBalancerMockRecorder {
+	return m.recorder
+}
+
+// QueueStats mocks base method.
+func (m *MockBalancer) QueueStats() loadbalance.QueueStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueStats")
+	ret0, _ := ret[0].(loadbalance.QueueStats)
+	return ret0
+}
+
+// QueueStats indicates an expected call of QueueStats.
+func (mr *MockBalancerMockRecorder) QueueStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueStats", reflect.TypeOf((*MockBalancer)(nil).QueueStats))
+}
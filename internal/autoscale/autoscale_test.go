@@ -0,0 +1,162 @@
+package autoscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/loadbalance"
+	"github.com/bibendi/gruf-relay/internal/worker"
+)
+
+func TestAutoscale(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Autoscale Suite")
+}
+
+var _ = Describe("Autoscaler", func() {
+	var (
+		ctrl       *gomock.Controller
+		m          *MockManager
+		lb         *MockBalancer
+		queue      loadbalance.QueueStats
+		workers    map[string]worker.Worker
+		stats      map[string]worker.PoolStats
+		spares     map[string]bool
+		autoscaler *Autoscaler
+	)
+
+	addWorker := func(name string) {
+		w := worker.NewMockWorker(ctrl)
+		w.EXPECT().Status().DoAndReturn(func() worker.Status {
+			return worker.Status{State: worker.StateReady, Spare: spares[name]}
+		}).AnyTimes()
+		w.EXPECT().PoolStats().DoAndReturn(func() worker.PoolStats {
+			return stats[name]
+		}).AnyTimes()
+		workers[name] = w
+		stats[name] = worker.PoolStats{Size: 5}
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		m = NewMockManager(ctrl)
+		workers = map[string]worker.Worker{}
+		stats = map[string]worker.PoolStats{}
+		spares = map[string]bool{}
+		m.EXPECT().GetWorkers().DoAndReturn(func() map[string]worker.Worker {
+			return workers
+		}).AnyTimes()
+		queue = loadbalance.QueueStats{}
+		lb = NewMockBalancer(ctrl)
+		lb.EXPECT().QueueStats().DoAndReturn(func() loadbalance.QueueStats {
+			return queue
+		}).AnyTimes()
+
+		addWorker("worker-1")
+		addWorker("worker-2")
+
+		autoscaler = NewAutoscaler(config.Workers{
+			Min: 1,
+			Max: 3,
+			Autoscale: config.Autoscale{
+				Interval:             time.Second,
+				ScaleUpUtilization:   0.8,
+				ScaleDownUtilization: 0.3,
+				ScaleUpWait:          50 * time.Millisecond,
+				ScaleUpCooldown:      30 * time.Second,
+				ScaleDownCooldown:    5 * time.Minute,
+			},
+		}, m, lb)
+		autoscaler.lastScale = time.Time{}
+
+		DeferCleanup(func() {
+			ctrl.Finish()
+		})
+	})
+
+	setInUse := func(inUse int) {
+		for name, st := range stats {
+			st.InUse = inUse
+			stats[name] = st
+		}
+	}
+
+	It("scales up when the pools are saturated", func() {
+		setInUse(4)
+		m.EXPECT().ScaleUp().Return(3, nil)
+		autoscaler.scale(context.Background())
+	})
+
+	It("scales up when requests wait in the queue for connections", func() {
+		setInUse(2)
+		queue = loadbalance.QueueStats{Dispatched: 100, WaitTime: time.Second}
+		autoscaler.sample()
+		queue = loadbalance.QueueStats{Dispatched: 110, WaitTime: 2 * time.Second}
+		m.EXPECT().ScaleUp().Return(3, nil)
+		autoscaler.scale(context.Background())
+	})
+
+	It("does not scale up for requests that waited before the previous sample", func() {
+		setInUse(2)
+		queue = loadbalance.QueueStats{Dispatched: 10, WaitTime: time.Second}
+		autoscaler.sample()
+		queue = loadbalance.QueueStats{Dispatched: 110, WaitTime: time.Second}
+		autoscaler.scale(context.Background())
+	})
+
+	It("does not scale above max", func() {
+		addWorker("worker-3")
+		setInUse(5)
+		autoscaler.scale(context.Background())
+	})
+
+	It("scales down when the pools are idle", func() {
+		m.EXPECT().ScaleDown(gomock.Any()).Return(1, nil)
+		autoscaler.scale(context.Background())
+	})
+
+	It("does not count idle spares", func() {
+		addWorker("worker-3")
+		spares["worker-3"] = true
+		stats["worker-1"] = worker.PoolStats{Size: 5, InUse: 4}
+		stats["worker-2"] = worker.PoolStats{Size: 5, InUse: 4}
+		m.EXPECT().ScaleUp().Return(3, nil)
+		autoscaler.scale(context.Background())
+	})
+
+	It("does not scale below min", func() {
+		delete(workers, "worker-2")
+		autoscaler.scale(context.Background())
+	})
+
+	It("does not scale down when the remaining workers would be saturated", func() {
+		autoscaler.downUtil = 0.5
+		setInUse(2)
+		autoscaler.scale(context.Background())
+	})
+
+	It("waits for the cooldown after scaling", func() {
+		setInUse(4)
+		m.EXPECT().ScaleUp().Return(3, nil)
+		autoscaler.scale(context.Background())
+
+		addWorker("worker-3")
+		setInUse(5)
+		autoscaler.max = 4
+		autoscaler.scale(context.Background())
+	})
+
+	It("applies the cooldown to failed attempts", func() {
+		setInUse(4)
+		m.EXPECT().ScaleUp().Return(2, errors.New("boom"))
+		autoscaler.scale(context.Background())
+		autoscaler.scale(context.Background())
+	})
+})
@@ -0,0 +1,23 @@
+package autoscale
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	decisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_autoscaler_decisions_total",
+		Help: "Total number of workers added or removed by the autoscaler.",
+	}, []string{"direction"})
+
+	poolUtilization = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gruf_relay_autoscaler_pool_utilization",
+		Help: "Share of worker connections in use at the last autoscaler sample.",
+	})
+
+	connectionWait = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gruf_relay_autoscaler_connection_wait_seconds",
+		Help: "Average time requests waited in the queue for a worker connection since the previous autoscaler sample.",
+	})
+)
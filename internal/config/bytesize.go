@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ByteSize is an amount of memory in bytes that can be written with a binary
+// unit suffix, e.g. "512Mi", "512MB" or "1G". Units are powers of 1024.
+type ByteSize int64
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i == -1 {
+		i = len(s)
+	}
+
+	value, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid byte size %q: %w", s, err)
+	}
+
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return fmt.Errorf("invalid byte size unit in %q", s)
+	}
+
+	*b = ByteSize(value) * unit
+	return nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Code is a gRPC status code written by name, e.g. "UNAVAILABLE".
+type Code codes.Code
+
+func (c *Code) UnmarshalText(text []byte) error {
+	var code codes.Code
+	name := strings.ToUpper(strings.TrimSpace(string(text)))
+	if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+		return fmt.Errorf("unknown status code %q", text)
+	}
+
+	*c = Code(code)
+	return nil
+}
+
+func (c Code) String() string {
+	return codes.Code(c).String()
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -41,6 +43,7 @@ type Config struct {
 	HealthCheck HealthCheck `yaml:"health_check"`
 	Probes      Probes
 	Metrics     Metrics
+	Admin       Admin
 }
 
 type Log struct {
@@ -49,16 +52,195 @@ type Log struct {
 }
 
 type Server struct {
-	Host         string        `yaml:"host" env:"SERVER_HOST" env-default:"0.0.0.0"`
-	Port         int           `yaml:"port" env:"SERVER_PORT" env-default:"8080"`
-	ProxyTimeout time.Duration `yaml:"proxy_timeout" env:"SERVER_PROXY_TIMEOUT" env-default:"5s"`
+	Host              string          `yaml:"host" env:"SERVER_HOST" env-default:"0.0.0.0"`
+	Port              int             `yaml:"port" env:"SERVER_PORT" env-default:"8080"`
+	ProxyTimeout      Timeout         `yaml:"proxy_timeout" env:"SERVER_PROXY_TIMEOUT" env-default:"5s"`
+	MaxTimeout        Timeout         `yaml:"max_timeout" env:"SERVER_MAX_TIMEOUT" env-default:"none"`
+	StreamIdleTimeout Timeout         `yaml:"stream_idle_timeout" env:"SERVER_STREAM_IDLE_TIMEOUT" env-default:"none"`
+	MethodTimeouts    []MethodTimeout `yaml:"method_timeouts"`
+	RetryPolicies     []RetryPolicy   `yaml:"retry_policies"`
+	RetryBuffer       RetryBuffer     `yaml:"retry_buffer"`
+	MinDeadline       time.Duration   `yaml:"min_deadline" env:"SERVER_MIN_DEADLINE" env-default:"0s"`
+	Queue             Queue           `yaml:"queue"`
+
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY" env-default:"0s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" env-default:"30s"`
+}
+
+// MethodTimeout overrides the server timeouts for the methods matching Method, a
+// full method name like "/pkg.Service/Method" or a glob like "/pkg.Service/*".
+// Default applies to requests without a client deadline, Max caps any deadline and
+// Idle cancels streams that pass no message in either direction for that long.
+// Timeouts that are not set are taken from the server.
+type MethodTimeout struct {
+	Method  string  `yaml:"method"`
+	Default Timeout `yaml:"default"`
+	Max     Timeout `yaml:"max"`
+	Idle    Timeout `yaml:"idle"`
+}
+
+// RetryPolicy replays requests of the methods matching Method, like in
+// MethodTimeout, on a worker picked anew when a worker fails them with one of
+// RetryableCodes before it sent a response.
+type RetryPolicy struct {
+	Method            string        `yaml:"method"`
+	MaxAttempts       int           `yaml:"max_attempts"`
+	RetryableCodes    []Code        `yaml:"retryable_codes"`
+	InitialBackoff    time.Duration `yaml:"initial_backoff"`
+	MaxBackoff        time.Duration `yaml:"max_backoff"`
+	BackoffMultiplier float64       `yaml:"backoff_multiplier"`
+}
+
+// RetryBuffer caps the request messages kept to replay a request on another
+// worker. Requests that exceed either cap are still proxied but not retried.
+type RetryBuffer struct {
+	MaxMessages int      `yaml:"max_messages" env:"SERVER_RETRY_BUFFER_MAX_MESSAGES" env-default:"16"`
+	MaxSize     ByteSize `yaml:"max_size" env:"SERVER_RETRY_BUFFER_MAX_SIZE" env-default:"256Ki"`
+}
+
+// Queue holds requests until a worker has a free connection. MaxDepth of zero
+// means the queue is unbounded. With the codel and adaptive_lifo disciplines the
+// queue counts as overloaded while the shortest wait within Interval exceeds Target.
+type Queue struct {
+	Timeout       time.Duration `yaml:"timeout" env:"SERVER_QUEUE_TIMEOUT" env-default:"5s"`
+	MaxDepth      int           `yaml:"max_depth" env:"SERVER_QUEUE_MAX_DEPTH" env-default:"0"`
+	Discipline    string        `yaml:"discipline" env:"SERVER_QUEUE_DISCIPLINE" env-default:"fifo"`
+	Target        time.Duration `yaml:"target" env:"SERVER_QUEUE_TARGET" env-default:"5ms"`
+	Interval      time.Duration `yaml:"interval" env:"SERVER_QUEUE_INTERVAL" env-default:"100ms"`
+	RetryPushback time.Duration `yaml:"retry_pushback" env:"SERVER_QUEUE_RETRY_PUSHBACK" env-default:"1s"`
 }
 
 type Workers struct {
-	Count       int    `yaml:"count" env:"WORKERS_COUNT" env-default:"2"`
-	StartPort   int    `yaml:"start_port" env:"WORKERS_START_PORT" env-default:"9000"`
-	MetricsPath string `yaml:"metrics_path" env:"WORKERS_METRICS_PATH" env-default:"/metrics"`
-	PoolSize    int    `yaml:"pool_size" env:"WORKERS_POOL_SIZE" env-default:"5"`
+	Count       int               `yaml:"count" env:"WORKERS_COUNT" env-default:"2"`
+	Min         int               `yaml:"min" env:"WORKERS_MIN" env-default:"1"`
+	Max         int               `yaml:"max" env:"WORKERS_MAX" env-default:"0"`
+	Spares      int               `yaml:"spares" env:"WORKERS_SPARES" env-default:"0"`
+	MetricsPath string            `yaml:"metrics_path" env:"WORKERS_METRICS_PATH" env-default:"/metrics"`
+	PoolSize    int               `yaml:"pool_size" env:"WORKERS_POOL_SIZE" env-default:"5"`
+	Command     []string          `yaml:"command" env:"WORKERS_COMMAND" env-separator:" " env-default:"bundle exec gruf --host {{.Addr}} --health-check --backtrace-on-error"`
+	Env         map[string]string `yaml:"env" env:"WORKERS_ENV" env-default:"PROMETHEUS_EXPORTER_PORT:{{.MetricsPort}},PROMETHEUS_EXPORTER_PATH:{{.MetricsPath}},RAILS_MAX_THREADS:{{.PoolSize}}"`
+	Dir         string            `yaml:"dir" env:"WORKERS_DIR"`
+	Restart     Restart           `yaml:"restart"`
+
+	BootTimeout     time.Duration `yaml:"boot_timeout" env:"WORKERS_BOOT_TIMEOUT" env-default:"60s"`
+	DrainTimeout    time.Duration `yaml:"drain_timeout" env:"WORKERS_DRAIN_TIMEOUT" env-default:"30s"`
+	StopSignal      Signal        `yaml:"stop_signal" env:"WORKERS_STOP_SIGNAL" env-default:"TERM"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"WORKERS_SHUTDOWN_TIMEOUT" env-default:"5s"`
+
+	Transport        string    `yaml:"transport" env:"WORKERS_TRANSPORT" env-default:"tcp"`
+	SocketDir        string    `yaml:"socket_dir" env:"WORKERS_SOCKET_DIR" env-default:"/tmp/gruf-relay"`
+	StartPort        int       `yaml:"start_port" env:"WORKERS_START_PORT" env-default:"9000"`
+	PortRange        PortRange `yaml:"port_range" env:"WORKERS_PORT_RANGE"`
+	MetricsPortRange PortRange `yaml:"metrics_port_range" env:"WORKERS_METRICS_PORT_RANGE"`
+
+	RollingRestart RollingRestart `yaml:"rolling_restart"`
+	Reload         Reload         `yaml:"reload"`
+	Autoscale      Autoscale      `yaml:"autoscale"`
+	Notify         Notify         `yaml:"notify"`
+	Watchdog       Watchdog       `yaml:"watchdog"`
+	Output         Output         `yaml:"output"`
+	CrashReports   CrashReports   `yaml:"crash_reports"`
+
+	MaxRequests       int `yaml:"max_requests" env:"WORKERS_MAX_REQUESTS" env-default:"0"`
+	MaxRequestsJitter int `yaml:"max_requests_jitter" env:"WORKERS_MAX_REQUESTS_JITTER" env-default:"0"`
+
+	MaxRSS             ByteSize      `yaml:"max_rss" env:"WORKERS_MAX_RSS" env-default:"0"`
+	MaxRSSDuration     time.Duration `yaml:"max_rss_duration" env:"WORKERS_MAX_RSS_DURATION" env-default:"30s"`
+	RSSInterval        time.Duration `yaml:"rss_interval" env:"WORKERS_RSS_INTERVAL" env-default:"10s"`
+	RSSIncludeChildren bool          `yaml:"rss_include_children" env:"WORKERS_RSS_INCLUDE_CHILDREN" env-default:"false"`
+}
+
+const (
+	TransportTCP  = "tcp"
+	TransportUnix = "unix"
+
+	OutputLog         = "log"
+	OutputPassthrough = "passthrough"
+
+	QueueFIFO         = "fifo"
+	QueueCoDel        = "codel"
+	QueueAdaptiveLIFO = "adaptive_lifo"
+
+	// Unix socket paths are limited to 108 bytes on Linux and 104 on macOS.
+	maxSocketPathLen = 103
+)
+
+// Without explicit ranges, worker metrics ports are allocated from this offset above start_port.
+const defaultMetricsPortOffset = 100
+
+// Ports returns the range worker ports are allocated from.
+func (w Workers) Ports() PortRange {
+	if !w.PortRange.IsZero() {
+		return w.PortRange
+	}
+	return PortRange{w.StartPort, maxPort}
+}
+
+// MetricsPorts returns the range worker metrics ports are allocated from.
+func (w Workers) MetricsPorts() PortRange {
+	if !w.MetricsPortRange.IsZero() {
+		return w.MetricsPortRange
+	}
+	return PortRange{w.StartPort + defaultMetricsPortOffset, maxPort}
+}
+
+type Restart struct {
+	InitialDelay      time.Duration `yaml:"initial_delay" env:"WORKERS_RESTART_INITIAL_DELAY" env-default:"1s"`
+	MaxDelay          time.Duration `yaml:"max_delay" env:"WORKERS_RESTART_MAX_DELAY" env-default:"30s"`
+	Multiplier        float64       `yaml:"multiplier" env:"WORKERS_RESTART_MULTIPLIER" env-default:"2"`
+	Jitter            float64       `yaml:"jitter" env:"WORKERS_RESTART_JITTER" env-default:"0.2"`
+	StableUptime      time.Duration `yaml:"stable_uptime" env:"WORKERS_RESTART_STABLE_UPTIME" env-default:"1m"`
+	CrashLoopRestarts int           `yaml:"crash_loop_restarts" env:"WORKERS_RESTART_CRASH_LOOP_RESTARTS" env-default:"5"`
+	CrashLoopWindow   time.Duration `yaml:"crash_loop_window" env:"WORKERS_RESTART_CRASH_LOOP_WINDOW" env-default:"5m"`
+	ExitOnCrashLoop   bool          `yaml:"exit_on_crash_loop" env:"WORKERS_RESTART_EXIT_ON_CRASH_LOOP" env-default:"false"`
+}
+
+type RollingRestart struct {
+	BatchSize     int           `yaml:"batch_size" env:"WORKERS_ROLLING_RESTART_BATCH_SIZE" env-default:"1"`
+	ReadyTimeout  time.Duration `yaml:"ready_timeout" env:"WORKERS_ROLLING_RESTART_READY_TIMEOUT" env-default:"2m"`
+	CheckInterval time.Duration `yaml:"check_interval" env:"WORKERS_ROLLING_RESTART_CHECK_INTERVAL" env-default:"1s"`
+}
+
+// Reload boots a new generation of workers from the freshly resolved workers.dir
+// and swaps it in once every worker of it is ready.
+type Reload struct {
+	ReadyTimeout  time.Duration `yaml:"ready_timeout" env:"WORKERS_RELOAD_READY_TIMEOUT" env-default:"2m"`
+	CheckInterval time.Duration `yaml:"check_interval" env:"WORKERS_RELOAD_CHECK_INTERVAL" env-default:"1s"`
+}
+
+type Autoscale struct {
+	Enabled              bool          `yaml:"enabled" env:"WORKERS_AUTOSCALE_ENABLED" env-default:"false"`
+	Interval             time.Duration `yaml:"interval" env:"WORKERS_AUTOSCALE_INTERVAL" env-default:"5s"`
+	ScaleUpUtilization   float64       `yaml:"scale_up_utilization" env:"WORKERS_AUTOSCALE_SCALE_UP_UTILIZATION" env-default:"0.8"`
+	ScaleDownUtilization float64       `yaml:"scale_down_utilization" env:"WORKERS_AUTOSCALE_SCALE_DOWN_UTILIZATION" env-default:"0.3"`
+	ScaleUpWait          time.Duration `yaml:"scale_up_wait" env:"WORKERS_AUTOSCALE_SCALE_UP_WAIT" env-default:"50ms"`
+	ScaleUpCooldown      time.Duration `yaml:"scale_up_cooldown" env:"WORKERS_AUTOSCALE_SCALE_UP_COOLDOWN" env-default:"30s"`
+	ScaleDownCooldown    time.Duration `yaml:"scale_down_cooldown" env:"WORKERS_AUTOSCALE_SCALE_DOWN_COOLDOWN" env-default:"5m"`
+}
+
+// Notify lets workers report their readiness over a datagram socket instead of being polled.
+type Notify struct {
+	Enabled         bool          `yaml:"enabled" env:"WORKERS_NOTIFY_ENABLED" env-default:"false"`
+	WatchdogTimeout time.Duration `yaml:"watchdog_timeout" env:"WORKERS_NOTIFY_WATCHDOG_TIMEOUT" env-default:"0s"`
+}
+
+// Watchdog restarts workers whose process runs but stops answering health checks.
+type Watchdog struct {
+	Timeouts    int           `yaml:"timeouts" env:"WORKERS_WATCHDOG_TIMEOUTS" env-default:"0"`
+	DumpSignal  Signal        `yaml:"dump_signal" env:"WORKERS_WATCHDOG_DUMP_SIGNAL" env-default:"QUIT"`
+	DumpTimeout time.Duration `yaml:"dump_timeout" env:"WORKERS_WATCHDOG_DUMP_TIMEOUT" env-default:"5s"`
+}
+
+// Output controls how the stdout and stderr of workers reach the relay output.
+type Output struct {
+	Mode          string   `yaml:"mode" env:"WORKERS_OUTPUT_MODE" env-default:"log"`
+	MaxLineLength ByteSize `yaml:"max_line_length" env:"WORKERS_OUTPUT_MAX_LINE_LENGTH" env-default:"64Ki"`
+}
+
+// CrashReports describe unexpected exits of workers along with their last output.
+type CrashReports struct {
+	OutputLines int `yaml:"output_lines" env:"WORKERS_CRASH_REPORTS_OUTPUT_LINES" env-default:"50"`
+	Keep        int `yaml:"keep" env:"WORKERS_CRASH_REPORTS_KEEP" env-default:"10"`
 }
 
 type HealthCheck struct {
@@ -69,6 +251,15 @@ type HealthCheck struct {
 type Probes struct {
 	Enabled bool `yaml:"enabled" env:"PROBES_ENABLED" env-default:"true"`
 	Port    int  `yaml:"port" env:"PROBES_PORT" env-default:"5555"`
+	// MinReadyWorkers is the number of ready active workers the readiness probe
+	// requires, capped by the number of active workers.
+	MinReadyWorkers int `yaml:"min_ready_workers" env:"PROBES_MIN_READY_WORKERS" env-default:"1"`
+}
+
+type Admin struct {
+	Enabled bool   `yaml:"enabled" env:"ADMIN_ENABLED" env-default:"false"`
+	Host    string `yaml:"host" env:"ADMIN_HOST" env-default:"127.0.0.1"`
+	Port    int    `yaml:"port" env:"ADMIN_PORT" env-default:"5556"`
 }
 
 type Metrics struct {
@@ -103,6 +294,61 @@ func (c *Config) validateConfig() error {
 		return fmt.Errorf("port must be a positive integer")
 	}
 
+	if c.Server.ShutdownDelay < 0 {
+		return fmt.Errorf("server shutdown_delay must not be negative")
+	}
+
+	if c.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("server shutdown_timeout must be a positive duration")
+	}
+
+	for _, mt := range c.Server.MethodTimeouts {
+		if _, err := path.Match(mt.Method, ""); mt.Method == "" || err != nil {
+			return fmt.Errorf("server method_timeouts method %q must be a full method name or glob", mt.Method)
+		}
+	}
+
+	for _, rp := range c.Server.RetryPolicies {
+		if err := rp.validate(); err != nil {
+			return fmt.Errorf("server retry_policies %q: %w", rp.Method, err)
+		}
+	}
+
+	if len(c.Server.RetryPolicies) > 0 {
+		if c.Server.RetryBuffer.MaxMessages <= 0 {
+			return fmt.Errorf("server retry_buffer max_messages must be positive")
+		}
+		if c.Server.RetryBuffer.MaxSize <= 0 {
+			return fmt.Errorf("server retry_buffer max_size must be positive")
+		}
+	}
+
+	if c.Server.MinDeadline < 0 {
+		return fmt.Errorf("server min_deadline must not be negative")
+	}
+
+	if c.Server.Queue.Timeout <= 0 {
+		return fmt.Errorf("server queue timeout must be a positive duration")
+	}
+
+	if c.Server.Queue.MaxDepth < 0 {
+		return fmt.Errorf("server queue max_depth must not be negative")
+	}
+
+	switch c.Server.Queue.Discipline {
+	case QueueFIFO:
+	case QueueCoDel, QueueAdaptiveLIFO:
+		if c.Server.Queue.Target <= 0 || c.Server.Queue.Interval <= 0 {
+			return fmt.Errorf("server queue target and interval must be positive durations")
+		}
+	default:
+		return fmt.Errorf("server queue discipline must be %q, %q or %q", QueueFIFO, QueueCoDel, QueueAdaptiveLIFO)
+	}
+
+	if c.Server.Queue.RetryPushback < 0 {
+		return fmt.Errorf("server queue retry_pushback must not be negative")
+	}
+
 	if c.HealthCheck.Interval <= 0 {
 		return fmt.Errorf("health_check_interval must be a positive duration")
 	}
@@ -111,8 +357,278 @@ func (c *Config) validateConfig() error {
 		return fmt.Errorf("workers count must be a positive integer")
 	}
 
-	if c.Workers.StartPort <= 0 {
-		return fmt.Errorf("workers start_port must be a positive integer")
+	if c.Workers.Min <= 0 {
+		return fmt.Errorf("workers min must be a positive integer")
+	}
+
+	if c.Workers.Max != 0 && c.Workers.Max < c.Workers.Min {
+		return fmt.Errorf("workers max must not be less than min")
+	}
+
+	if c.Workers.Count < c.Workers.Min || (c.Workers.Max != 0 && c.Workers.Count > c.Workers.Max) {
+		return fmt.Errorf("workers count must be between min and max")
+	}
+
+	if c.Workers.Spares < 0 {
+		return fmt.Errorf("workers spares must not be negative")
+	}
+
+	if c.Workers.StartPort <= 0 || c.Workers.StartPort+defaultMetricsPortOffset > maxPort {
+		return fmt.Errorf("workers start_port must be a positive integer below %d", maxPort-defaultMetricsPortOffset)
+	}
+
+	switch c.Workers.Transport {
+	case TransportTCP:
+		if err := c.validatePortRanges(); err != nil {
+			return fmt.Errorf("workers: %w", err)
+		}
+	case TransportUnix:
+		if err := c.Workers.validateSocketDir(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("workers transport must be %q or %q", TransportTCP, TransportUnix)
+	}
+
+	if c.Workers.Notify.Enabled {
+		if err := c.Workers.validateSocketDir(); err != nil {
+			return err
+		}
+	}
+
+	if c.Workers.Notify.WatchdogTimeout < 0 {
+		return fmt.Errorf("workers notify watchdog_timeout must not be negative")
+	}
+
+	if len(c.Workers.Command) == 0 {
+		return fmt.Errorf("workers command must not be empty")
+	}
+
+	for _, arg := range c.Workers.Command {
+		if err := validateTemplate(arg); err != nil {
+			return fmt.Errorf("workers command: %w", err)
+		}
+	}
+
+	for name, value := range c.Workers.Env {
+		if err := validateTemplate(value); err != nil {
+			return fmt.Errorf("workers env %s: %w", name, err)
+		}
+	}
+
+	if c.Workers.MaxRequests < 0 || c.Workers.MaxRequestsJitter < 0 {
+		return fmt.Errorf("workers max_requests and max_requests_jitter must not be negative")
+	}
+
+	if c.Workers.MaxRSS < 0 || c.Workers.MaxRSSDuration < 0 || c.Workers.RSSInterval < 0 {
+		return fmt.Errorf("workers max_rss, max_rss_duration and rss_interval must not be negative")
+	}
+
+	if c.Workers.MaxRSS > 0 && c.Workers.RSSInterval == 0 {
+		return fmt.Errorf("workers rss_interval must be set when max_rss is enabled")
+	}
+
+	if c.Workers.BootTimeout < 0 {
+		return fmt.Errorf("workers boot_timeout must not be negative")
+	}
+
+	if c.Workers.DrainTimeout < 0 {
+		return fmt.Errorf("workers drain_timeout must not be negative")
+	}
+
+	if c.Workers.ShutdownTimeout <= 0 {
+		return fmt.Errorf("workers shutdown_timeout must be a positive duration")
+	}
+
+	if c.Workers.StopSignal == 0 {
+		return fmt.Errorf("workers stop_signal must be set")
+	}
+
+	if c.Workers.Watchdog.Timeouts < 0 {
+		return fmt.Errorf("workers watchdog timeouts must not be negative")
+	}
+
+	if c.Workers.Watchdog.Timeouts > 0 && (c.Workers.Watchdog.DumpSignal == 0 || c.Workers.Watchdog.DumpTimeout < 0) {
+		return fmt.Errorf("workers watchdog dump_signal must be set and dump_timeout must not be negative")
+	}
+
+	switch c.Workers.Output.Mode {
+	case OutputLog:
+		if c.Workers.Output.MaxLineLength <= 0 {
+			return fmt.Errorf("workers output max_line_length must be positive")
+		}
+	case OutputPassthrough:
+	default:
+		return fmt.Errorf("workers output mode must be %q or %q", OutputLog, OutputPassthrough)
+	}
+
+	if c.Workers.CrashReports.OutputLines < 0 || c.Workers.CrashReports.Keep < 0 {
+		return fmt.Errorf("workers crash_reports output_lines and keep must not be negative")
+	}
+
+	if err := c.Workers.Restart.validate(); err != nil {
+		return fmt.Errorf("workers restart: %w", err)
+	}
+
+	if c.Workers.RollingRestart.BatchSize <= 0 {
+		return fmt.Errorf("workers rolling_restart batch_size must be a positive integer")
+	}
+
+	if c.Workers.RollingRestart.ReadyTimeout <= 0 || c.Workers.RollingRestart.CheckInterval <= 0 {
+		return fmt.Errorf("workers rolling_restart ready_timeout and check_interval must be positive durations")
+	}
+
+	if c.Workers.Reload.ReadyTimeout <= 0 || c.Workers.Reload.CheckInterval <= 0 {
+		return fmt.Errorf("workers reload ready_timeout and check_interval must be positive durations")
+	}
+
+	if c.Workers.Autoscale.Enabled {
+		if c.Workers.Max == 0 {
+			return fmt.Errorf("workers max must be set when autoscaling is enabled")
+		}
+
+		if err := c.Workers.Autoscale.validate(); err != nil {
+			return fmt.Errorf("workers autoscale: %w", err)
+		}
+	}
+
+	if c.Probes.Enabled && c.Probes.MinReadyWorkers <= 0 {
+		return fmt.Errorf("probes min_ready_workers must be a positive integer")
+	}
+
+	if c.Admin.Enabled && c.Admin.Port <= 0 {
+		return fmt.Errorf("admin port must be a positive integer")
+	}
+
+	return nil
+}
+
+// RelayPorts returns the ports the relay listens on itself, so that they are never given to workers.
+func (c *Config) RelayPorts() map[string]int {
+	ports := map[string]int{"server": c.Server.Port}
+	if c.Probes.Enabled {
+		ports["probes"] = c.Probes.Port
+	}
+	if c.Metrics.Enabled {
+		ports["metrics"] = c.Metrics.Port
+	}
+	if c.Admin.Enabled {
+		ports["admin"] = c.Admin.Port
+	}
+	return ports
+}
+
+// validatePortRanges checks explicit port ranges. They must fit twice the workers, as a
+// reload boots a whole new generation next to the current one. Ports taken by the relay
+// itself or by other processes are skipped when allocating from the open-ended default ranges.
+func (c *Config) validatePortRanges() error {
+	ranges := map[string]PortRange{
+		"port_range":         c.Workers.PortRange,
+		"metrics_port_range": c.Workers.MetricsPortRange,
+	}
+
+	for name, r := range ranges {
+		if r.IsZero() {
+			continue
+		}
+
+		if r.Size() < 2*(max(c.Workers.Count, c.Workers.Max)+c.Workers.Spares) {
+			return fmt.Errorf("%s %s is too small for the number of workers and a reload", name, r)
+		}
+
+		for relay, port := range c.RelayPorts() {
+			if r.Contains(port) {
+				return fmt.Errorf("%s %s includes the %s port %d", name, r, relay, port)
+			}
+		}
+	}
+
+	if !c.Workers.PortRange.IsZero() && !c.Workers.MetricsPortRange.IsZero() && c.Workers.PortRange.Overlaps(c.Workers.MetricsPortRange) {
+		return fmt.Errorf("port_range %s overlaps metrics_port_range %s", c.Workers.PortRange, c.Workers.MetricsPortRange)
+	}
+
+	return nil
+}
+
+func (w Workers) validateSocketDir() error {
+	// The longest socket name belongs to the metrics socket of a worker with a large index.
+	if w.SocketDir == "" || len(filepath.Join(w.SocketDir, "worker-1000-metrics.sock")) > maxSocketPathLen {
+		return fmt.Errorf("workers socket_dir must be set and short enough for unix socket paths")
+	}
+	return nil
+}
+
+func (r RetryPolicy) validate() error {
+	if _, err := path.Match(r.Method, ""); r.Method == "" || err != nil {
+		return fmt.Errorf("method must be a full method name or glob")
+	}
+
+	if r.MaxAttempts < 2 {
+		return fmt.Errorf("max_attempts must be at least 2")
+	}
+
+	if len(r.RetryableCodes) == 0 {
+		return fmt.Errorf("retryable_codes must not be empty")
+	}
+
+	if r.InitialBackoff < 0 || r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("initial_backoff must not be negative and max_backoff must not be less than it")
+	}
+
+	if r.BackoffMultiplier < 1 {
+		return fmt.Errorf("backoff_multiplier must be greater than or equal to 1")
+	}
+
+	return nil
+}
+
+func (r Restart) validate() error {
+	if r.InitialDelay <= 0 {
+		return fmt.Errorf("initial_delay must be a positive duration")
+	}
+
+	if r.MaxDelay < r.InitialDelay {
+		return fmt.Errorf("max_delay must not be less than initial_delay")
+	}
+
+	if r.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be greater than or equal to 1")
+	}
+
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+
+	if r.StableUptime <= 0 {
+		return fmt.Errorf("stable_uptime must be a positive duration")
+	}
+
+	if r.CrashLoopRestarts < 0 {
+		return fmt.Errorf("crash_loop_restarts must not be negative")
+	}
+
+	if r.CrashLoopRestarts > 0 && r.CrashLoopWindow <= 0 {
+		return fmt.Errorf("crash_loop_window must be a positive duration")
+	}
+
+	return nil
+}
+
+func (a Autoscale) validate() error {
+	if a.Interval <= 0 {
+		return fmt.Errorf("interval must be a positive duration")
+	}
+
+	if a.ScaleUpUtilization <= 0 || a.ScaleUpUtilization > 1 {
+		return fmt.Errorf("scale_up_utilization must be greater than 0 and at most 1")
+	}
+
+	if a.ScaleDownUtilization < 0 || a.ScaleDownUtilization >= a.ScaleUpUtilization {
+		return fmt.Errorf("scale_down_utilization must not be negative and must be less than scale_up_utilization")
+	}
+
+	if a.ScaleUpWait < 0 || a.ScaleUpCooldown < 0 || a.ScaleDownCooldown < 0 {
+		return fmt.Errorf("scale_up_wait, scale_up_cooldown and scale_down_cooldown must not be negative")
 	}
 
 	return nil
@@ -2,11 +2,14 @@ package config
 
 import (
 	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
 )
 
 func TestConfig(t *testing.T) {
@@ -21,15 +24,35 @@ log:
 server:
   host: "127.0.0.1"
   port: 8081
+  proxy_timeout: 10s
+  method_timeouts:
+    - method: "/export.Exports/*"
+      default: none
+      idle: 30s
+  retry_policies:
+    - method: "/users.Users/*"
+      max_attempts: 3
+      retryable_codes: [UNAVAILABLE, resource_exhausted]
+      initial_backoff: 50ms
+      max_backoff: 1s
+      backoff_multiplier: 2
 health_check:
   interval: 10s
 workers:
   count: 4
   start_port: 9001
+  port_range: "9001-9010"
+  stop_signal: QUIT
   metrics_path: "/worker-metrics"
+  max_rss: 512Mi
+  command: ["bin/gruf", "--host", "{{.Addr}}"]
+  env:
+    PROMETHEUS_EXPORTER_PORT: "{{.MetricsPort}}"
+    WORKER_NAME: "{{.Name}}"
 probes:
   enabled: true
   port: 5556
+  min_ready_workers: 2
 metrics:
   enabled: true
   port: 9395
@@ -64,14 +87,36 @@ var _ = Describe("Config", func() {
 			Expect(cfg.Log.Format).To(Equal("json"))
 			Expect(cfg.Server.Host).To(Equal("127.0.0.1"))
 			Expect(cfg.Server.Port).To(Equal(8081))
+			Expect(cfg.Server.ProxyTimeout).To(Equal(Timeout(10 * time.Second)))
+			Expect(cfg.Server.MethodTimeouts).To(Equal([]MethodTimeout{
+				{Method: "/export.Exports/*", Default: NoTimeout, Idle: Timeout(30 * time.Second)},
+			}))
+			Expect(cfg.Server.RetryPolicies).To(Equal([]RetryPolicy{{
+				Method:            "/users.Users/*",
+				MaxAttempts:       3,
+				RetryableCodes:    []Code{Code(codes.Unavailable), Code(codes.ResourceExhausted)},
+				InitialBackoff:    50 * time.Millisecond,
+				MaxBackoff:        time.Second,
+				BackoffMultiplier: 2,
+			}}))
 			Expect(cfg.HealthCheck.Interval).To(Equal(10 * time.Second))
 
 			Expect(cfg.Workers.Count).To(Equal(4))
 			Expect(cfg.Workers.StartPort).To(Equal(9001))
+			Expect(cfg.Workers.PortRange).To(Equal(PortRange{9001, 9010}))
+			Expect(cfg.Workers.StopSignal).To(Equal(Signal(syscall.SIGQUIT)))
+			Expect(cfg.Workers.MetricsPorts()).To(Equal(PortRange{9101, 65535}))
 			Expect(cfg.Workers.MetricsPath).To(Equal("/worker-metrics"))
+			Expect(cfg.Workers.MaxRSS).To(Equal(ByteSize(512 * 1024 * 1024)))
+			Expect(cfg.Workers.Command).To(Equal([]string{"bin/gruf", "--host", "{{.Addr}}"}))
+			Expect(cfg.Workers.Env).To(Equal(map[string]string{
+				"PROMETHEUS_EXPORTER_PORT": "{{.MetricsPort}}",
+				"WORKER_NAME":              "{{.Name}}",
+			}))
 
 			Expect(cfg.Probes.Enabled).To(BeTrue())
 			Expect(cfg.Probes.Port).To(Equal(5556))
+			Expect(cfg.Probes.MinReadyWorkers).To(Equal(2))
 
 			Expect(cfg.Metrics.Enabled).To(BeTrue())
 			Expect(cfg.Metrics.Port).To(Equal(9395))
@@ -88,6 +133,50 @@ var _ = Describe("Config", func() {
 				cfg = MustLoadConfig()
 			}).NotTo(Panic())
 			Expect(cfg.Log.Level).To(Equal("warn"))
+			Expect(cfg.Workers.Command).To(Equal([]string{
+				"bundle", "exec", "gruf", "--host", "{{.Addr}}", "--health-check", "--backtrace-on-error",
+			}))
+			Expect(cfg.Workers.Env).To(HaveKeyWithValue("PROMETHEUS_EXPORTER_PORT", "{{.MetricsPort}}"))
+			Expect(cfg.Workers.Env).To(HaveKeyWithValue("RAILS_MAX_THREADS", "{{.PoolSize}}"))
+			Expect(cfg.Workers.Restart.InitialDelay).To(Equal(time.Second))
+			Expect(cfg.Workers.Restart.MaxDelay).To(Equal(30 * time.Second))
+			Expect(cfg.Workers.Restart.Multiplier).To(Equal(2.0))
+			Expect(cfg.Workers.Restart.CrashLoopRestarts).To(Equal(5))
+			Expect(cfg.Workers.Restart.ExitOnCrashLoop).To(BeFalse())
+			Expect(cfg.Workers.MaxRSS).To(Equal(ByteSize(0)))
+			Expect(cfg.Workers.RSSInterval).To(Equal(10 * time.Second))
+			Expect(cfg.Workers.RollingRestart.BatchSize).To(Equal(1))
+			Expect(cfg.Workers.Reload.ReadyTimeout).To(Equal(2 * time.Minute))
+			Expect(cfg.Workers.Dir).To(BeEmpty())
+			Expect(cfg.Workers.Min).To(Equal(1))
+			Expect(cfg.Workers.PortRange.IsZero()).To(BeTrue())
+			Expect(cfg.Workers.Transport).To(Equal(TransportTCP))
+			Expect(cfg.Server.ShutdownDelay).To(BeZero())
+			Expect(cfg.Server.ShutdownTimeout).To(Equal(30 * time.Second))
+			Expect(cfg.Server.ProxyTimeout).To(Equal(Timeout(5 * time.Second)))
+			Expect(cfg.Server.MaxTimeout).To(Equal(NoTimeout))
+			Expect(cfg.Server.StreamIdleTimeout).To(Equal(NoTimeout))
+			Expect(cfg.Server.Queue.Timeout).To(Equal(5 * time.Second))
+			Expect(cfg.Server.Queue.MaxDepth).To(BeZero())
+			Expect(cfg.Server.Queue.Discipline).To(Equal(QueueFIFO))
+			Expect(cfg.Server.Queue.RetryPushback).To(Equal(time.Second))
+			Expect(cfg.Server.RetryBuffer.MaxMessages).To(Equal(16))
+			Expect(cfg.Server.RetryBuffer.MaxSize).To(Equal(ByteSize(256 << 10)))
+			Expect(cfg.Workers.BootTimeout).To(Equal(time.Minute))
+			Expect(cfg.Workers.DrainTimeout).To(Equal(30 * time.Second))
+			Expect(cfg.Workers.StopSignal).To(Equal(Signal(syscall.SIGTERM)))
+			Expect(cfg.Workers.ShutdownTimeout).To(Equal(5 * time.Second))
+			Expect(cfg.Workers.Autoscale.Enabled).To(BeFalse())
+			Expect(cfg.Workers.Notify.Enabled).To(BeFalse())
+			Expect(cfg.Workers.Watchdog.Timeouts).To(BeZero())
+			Expect(cfg.Workers.Output.Mode).To(Equal(OutputLog))
+			Expect(cfg.Workers.CrashReports.OutputLines).To(Equal(50))
+			Expect(cfg.Workers.CrashReports.Keep).To(Equal(10))
+			Expect(cfg.Workers.Output.MaxLineLength).To(Equal(ByteSize(64 << 10)))
+			Expect(cfg.Workers.Watchdog.DumpSignal).To(Equal(Signal(syscall.SIGQUIT)))
+			Expect(cfg.Workers.Autoscale.ScaleUpUtilization).To(Equal(0.8))
+			Expect(cfg.Admin.Enabled).To(BeFalse())
+			Expect(cfg.Admin.Host).To(Equal("127.0.0.1"))
 		})
 
 		It("should load config from env variable CONFIG_PATH", func() {
@@ -114,14 +203,53 @@ var _ = Describe("Config", func() {
 			// Initialize with a valid configuration
 			config = Config{
 				Server: Server{
-					Port: 8080,
+					Port:            8080,
+					ShutdownTimeout: 30 * time.Second,
+					RetryBuffer: RetryBuffer{
+						MaxMessages: 16,
+						MaxSize:     256 << 10,
+					},
+					Queue: Queue{
+						Timeout:    5 * time.Second,
+						Discipline: QueueFIFO,
+					},
 				},
 				HealthCheck: HealthCheck{
 					Interval: 5 * time.Second,
 				},
 				Workers: Workers{
 					Count:     2,
+					Min:       1,
 					StartPort: 9000,
+					Transport: TransportTCP,
+					Command:   []string{"bundle", "exec", "gruf", "--host", "{{.Addr}}"},
+					Env:       map[string]string{"RAILS_MAX_THREADS": "{{.PoolSize}}"},
+					Restart: Restart{
+						InitialDelay:      time.Second,
+						MaxDelay:          30 * time.Second,
+						Multiplier:        2,
+						Jitter:            0.2,
+						StableUptime:      time.Minute,
+						CrashLoopRestarts: 5,
+						CrashLoopWindow:   5 * time.Minute,
+					},
+					BootTimeout:     time.Minute,
+					DrainTimeout:    30 * time.Second,
+					StopSignal:      Signal(syscall.SIGTERM),
+					ShutdownTimeout: 5 * time.Second,
+					RollingRestart: RollingRestart{
+						BatchSize:     1,
+						ReadyTimeout:  2 * time.Minute,
+						CheckInterval: time.Second,
+					},
+					Reload: Reload{
+						ReadyTimeout:  2 * time.Minute,
+						CheckInterval: time.Second,
+					},
+					Output: Output{
+						Mode:          OutputLog,
+						MaxLineLength: 64 << 10,
+					},
 				},
 			}
 		})
@@ -146,6 +274,282 @@ var _ = Describe("Config", func() {
 			Entry("invalid health check interval", func(config *Config) { config.HealthCheck.Interval = 0 }, false),
 			Entry("invalid workers count", func(config *Config) { config.Workers.Count = 0 }, false),
 			Entry("invalid workers start port", func(config *Config) { config.Workers.StartPort = 0 }, false),
+			Entry("empty workers command", func(config *Config) { config.Workers.Command = nil }, false),
+			Entry("unknown field in workers command", func(config *Config) { config.Workers.Command = []string{"gruf", "{{.Host}}"} }, false),
+			Entry("malformed workers command", func(config *Config) { config.Workers.Command = []string{"gruf", "{{.Addr"} }, false),
+			Entry("unknown field in workers env", func(config *Config) { config.Workers.Env = map[string]string{"PORT": "{{.Foo}}"} }, false),
+			Entry("unknown field in a workers command branch", func(config *Config) {
+				config.Workers.Command = []string{"gruf", "{{if .Index}}{{.Foo}}{{end}}"}
+			}, false),
+			Entry("unknown field in a workers env else branch", func(config *Config) {
+				config.Workers.Env = map[string]string{"PORT": "{{if .Port}}{{.Port}}{{else}}{{$.Host}}{{end}}"}
+			}, false),
+			Entry("nested field in workers env", func(config *Config) { config.Workers.Env = map[string]string{"NAME": "{{.Name.Size}}"} }, false),
+			Entry("known fields in workers command branches", func(config *Config) {
+				config.Workers.Command = []string{"gruf", "{{if .Socket}}--socket={{.Socket}}{{else}}--host={{.Addr}}{{end}}"}
+			}, true),
+			Entry("negative max rss", func(config *Config) { config.Workers.MaxRSS = -1 }, false),
+			Entry("max rss without sampling", func(config *Config) {
+				config.Workers.MaxRSS = 512 << 20
+				config.Workers.RSSInterval = 0
+			}, false),
+			Entry("negative max requests", func(config *Config) { config.Workers.MaxRequests = -1 }, false),
+			Entry("negative max requests jitter", func(config *Config) { config.Workers.MaxRequestsJitter = -1 }, false),
+			Entry("invalid restart initial delay", func(config *Config) { config.Workers.Restart.InitialDelay = 0 }, false),
+			Entry("restart max delay below initial delay", func(config *Config) { config.Workers.Restart.MaxDelay = time.Millisecond }, false),
+			Entry("restart multiplier below one", func(config *Config) { config.Workers.Restart.Multiplier = 0.5 }, false),
+			Entry("restart jitter above one", func(config *Config) { config.Workers.Restart.Jitter = 1.5 }, false),
+			Entry("invalid restart stable uptime", func(config *Config) { config.Workers.Restart.StableUptime = 0 }, false),
+			Entry("invalid crash loop window", func(config *Config) { config.Workers.Restart.CrashLoopWindow = 0 }, false),
+			Entry("invalid rolling restart batch size", func(config *Config) { config.Workers.RollingRestart.BatchSize = 0 }, false),
+			Entry("invalid rolling restart ready timeout", func(config *Config) { config.Workers.RollingRestart.ReadyTimeout = 0 }, false),
+			Entry("invalid rolling restart check interval", func(config *Config) { config.Workers.RollingRestart.CheckInterval = 0 }, false),
+			Entry("invalid reload ready timeout", func(config *Config) { config.Workers.Reload.ReadyTimeout = 0 }, false),
+			Entry("invalid reload check interval", func(config *Config) { config.Workers.Reload.CheckInterval = 0 }, false),
+			Entry("invalid workers min", func(config *Config) { config.Workers.Min = 0 }, false),
+			Entry("workers max below min", func(config *Config) {
+				config.Workers.Min = 2
+				config.Workers.Max = 1
+			}, false),
+			Entry("workers count above max", func(config *Config) { config.Workers.Max = 1 }, false),
+			Entry("negative workers spares", func(config *Config) { config.Workers.Spares = -1 }, false),
+			Entry("autoscaling without max", func(config *Config) {
+				config.Workers.Autoscale = Autoscale{Enabled: true, Interval: time.Second, ScaleUpUtilization: 0.8, ScaleDownUtilization: 0.3}
+			}, false),
+			Entry("autoscaling without hysteresis", func(config *Config) {
+				config.Workers.Max = 4
+				config.Workers.Autoscale = Autoscale{Enabled: true, Interval: time.Second, ScaleUpUtilization: 0.5, ScaleDownUtilization: 0.5}
+			}, false),
+			Entry("autoscaling", func(config *Config) {
+				config.Workers.Max = 4
+				config.Workers.Autoscale = Autoscale{Enabled: true, Interval: time.Second, ScaleUpUtilization: 0.8, ScaleDownUtilization: 0.3}
+			}, true),
+			Entry("port range too small", func(config *Config) { config.Workers.PortRange = PortRange{9000, 9000} }, false),
+			Entry("port range too small for spares", func(config *Config) {
+				config.Workers.Spares = 1
+				config.Workers.PortRange = PortRange{9000, 9004}
+			}, false),
+			Entry("port range with room for spares and a reload", func(config *Config) {
+				config.Workers.Spares = 1
+				config.Workers.PortRange = PortRange{9000, 9005}
+			}, true),
+			Entry("port range without room for a reload", func(config *Config) { config.Workers.PortRange = PortRange{9000, 9002} }, false),
+			Entry("port range with room for a reload", func(config *Config) { config.Workers.PortRange = PortRange{9000, 9003} }, true),
+			Entry("port range including the server port", func(config *Config) { config.Workers.PortRange = PortRange{8000, 8099} }, false),
+			Entry("invalid probes min ready workers", func(config *Config) {
+				config.Probes = Probes{Enabled: true, Port: 5555}
+			}, false),
+			Entry("metrics port range including the probes port", func(config *Config) {
+				config.Probes = Probes{Enabled: true, Port: 9150, MinReadyWorkers: 1}
+				config.Workers.MetricsPortRange = PortRange{9100, 9199}
+			}, false),
+			Entry("overlapping port ranges", func(config *Config) {
+				config.Workers.PortRange = PortRange{9000, 9099}
+				config.Workers.MetricsPortRange = PortRange{9050, 9149}
+			}, false),
+			Entry("disjoint port ranges", func(config *Config) {
+				config.Workers.PortRange = PortRange{9000, 9099}
+				config.Workers.MetricsPortRange = PortRange{9100, 9199}
+			}, true),
+			Entry("negative server shutdown delay", func(config *Config) { config.Server.ShutdownDelay = -1 }, false),
+			Entry("invalid server shutdown timeout", func(config *Config) { config.Server.ShutdownTimeout = 0 }, false),
+			Entry("empty method timeout method", func(config *Config) {
+				config.Server.MethodTimeouts = []MethodTimeout{{Default: NoTimeout}}
+			}, false),
+			Entry("malformed method timeout glob", func(config *Config) {
+				config.Server.MethodTimeouts = []MethodTimeout{{Method: "/export.Exports/[", Default: NoTimeout}}
+			}, false),
+			Entry("retry policy", func(config *Config) {
+				config.Server.RetryPolicies = []RetryPolicy{validRetryPolicy()}
+			}, true),
+			Entry("retry policy with a single attempt", func(config *Config) {
+				rp := validRetryPolicy()
+				rp.MaxAttempts = 1
+				config.Server.RetryPolicies = []RetryPolicy{rp}
+			}, false),
+			Entry("retry policy without codes", func(config *Config) {
+				rp := validRetryPolicy()
+				rp.RetryableCodes = nil
+				config.Server.RetryPolicies = []RetryPolicy{rp}
+			}, false),
+			Entry("retry policy max backoff below initial backoff", func(config *Config) {
+				rp := validRetryPolicy()
+				rp.MaxBackoff = time.Millisecond
+				config.Server.RetryPolicies = []RetryPolicy{rp}
+			}, false),
+			Entry("retry policy backoff multiplier below one", func(config *Config) {
+				rp := validRetryPolicy()
+				rp.BackoffMultiplier = 0
+				config.Server.RetryPolicies = []RetryPolicy{rp}
+			}, false),
+			Entry("retry policy without retry buffer messages", func(config *Config) {
+				config.Server.RetryPolicies = []RetryPolicy{validRetryPolicy()}
+				config.Server.RetryBuffer.MaxMessages = 0
+			}, false),
+			Entry("retry policy without retry buffer size", func(config *Config) {
+				config.Server.RetryPolicies = []RetryPolicy{validRetryPolicy()}
+				config.Server.RetryBuffer.MaxSize = 0
+			}, false),
+			Entry("no retry buffer without retry policies", func(config *Config) {
+				config.Server.RetryBuffer = RetryBuffer{}
+			}, true),
+			Entry("negative server min deadline", func(config *Config) { config.Server.MinDeadline = -1 }, false),
+			Entry("invalid server queue timeout", func(config *Config) { config.Server.Queue.Timeout = 0 }, false),
+			Entry("negative server queue max depth", func(config *Config) { config.Server.Queue.MaxDepth = -1 }, false),
+			Entry("unknown server queue discipline", func(config *Config) { config.Server.Queue.Discipline = "lifo" }, false),
+			Entry("codel queue without target", func(config *Config) { config.Server.Queue.Discipline = QueueCoDel }, false),
+			Entry("codel queue", func(config *Config) {
+				config.Server.Queue.Discipline = QueueCoDel
+				config.Server.Queue.Target = 5 * time.Millisecond
+				config.Server.Queue.Interval = 100 * time.Millisecond
+			}, true),
+			Entry("negative server queue retry pushback", func(config *Config) { config.Server.Queue.RetryPushback = -1 }, false),
+			Entry("negative boot timeout", func(config *Config) { config.Workers.BootTimeout = -1 }, false),
+			Entry("disabled boot timeout", func(config *Config) { config.Workers.BootTimeout = 0 }, true),
+			Entry("negative drain timeout", func(config *Config) { config.Workers.DrainTimeout = -1 }, false),
+			Entry("invalid shutdown timeout", func(config *Config) { config.Workers.ShutdownTimeout = 0 }, false),
+			Entry("missing stop signal", func(config *Config) { config.Workers.StopSignal = 0 }, false),
+			Entry("unknown workers transport", func(config *Config) { config.Workers.Transport = "udp" }, false),
+			Entry("unix transport", func(config *Config) {
+				config.Workers.Transport = TransportUnix
+				config.Workers.SocketDir = "/run/gruf-relay"
+			}, true),
+			Entry("unix transport without socket dir", func(config *Config) { config.Workers.Transport = TransportUnix }, false),
+			Entry("unix transport with long socket dir", func(config *Config) {
+				config.Workers.Transport = TransportUnix
+				config.Workers.SocketDir = "/" + strings.Repeat("a", 100)
+			}, false),
+			Entry("notify socket", func(config *Config) {
+				config.Workers.Notify.Enabled = true
+				config.Workers.SocketDir = "/run/gruf-relay"
+			}, true),
+			Entry("notify socket without socket dir", func(config *Config) { config.Workers.Notify.Enabled = true }, false),
+			Entry("hung worker watchdog", func(config *Config) {
+				config.Workers.Watchdog.Timeouts = 3
+				config.Workers.Watchdog.DumpSignal = Signal(syscall.SIGCONT)
+			}, true),
+			Entry("negative watchdog timeouts", func(config *Config) { config.Workers.Watchdog.Timeouts = -1 }, false),
+			Entry("watchdog without dump signal", func(config *Config) { config.Workers.Watchdog.Timeouts = 3 }, false),
+			Entry("passthrough output", func(config *Config) { config.Workers.Output.Mode = OutputPassthrough }, true),
+			Entry("unknown output mode", func(config *Config) { config.Workers.Output.Mode = "file" }, false),
+			Entry("invalid output max line length", func(config *Config) { config.Workers.Output.MaxLineLength = 0 }, false),
+			Entry("disabled crash report output", func(config *Config) { config.Workers.CrashReports.OutputLines = 0 }, true),
+			Entry("negative crash reports kept", func(config *Config) { config.Workers.CrashReports.Keep = -1 }, false),
+			Entry("negative notify watchdog timeout", func(config *Config) { config.Workers.Notify.WatchdogTimeout = -1 }, false),
+			Entry("invalid admin port", func(config *Config) {
+				config.Admin.Enabled = true
+				config.Admin.Port = 0
+			}, false),
+			Entry("disabled crash loop detection", func(config *Config) {
+				config.Workers.Restart.CrashLoopRestarts = 0
+				config.Workers.Restart.CrashLoopWindow = 0
+			}, true),
+			Entry("all known fields", func(config *Config) {
+				config.Workers.Command = []string{"{{.Name}}", "{{.Index}}", "{{.Addr}}", "{{.Port}}", "{{.MetricsPort}}", "{{.MetricsPath}}", "{{.PoolSize}}", "{{.NotifySocket}}"}
+			}, true),
 		)
 	})
+
+	DescribeTable("PortRange",
+		func(text string, expected PortRange, valid bool) {
+			var r PortRange
+			err := r.UnmarshalText([]byte(text))
+			if !valid {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(Equal(expected))
+		},
+		Entry("range", "9000-9099", PortRange{9000, 9099}, true),
+		Entry("range with spaces", " 9000 - 9099 ", PortRange{9000, 9099}, true),
+		Entry("single port", "9000-9000", PortRange{9000, 9000}, true),
+		Entry("empty", "", PortRange{}, true),
+		Entry("descending", "9099-9000", PortRange{}, false),
+		Entry("above max port", "65000-70000", PortRange{}, false),
+		Entry("no separator", "9000", PortRange{}, false),
+	)
+
+	DescribeTable("Signal",
+		func(text string, expected syscall.Signal, valid bool) {
+			var sig Signal
+			err := sig.UnmarshalText([]byte(text))
+			if !valid {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sig).To(Equal(Signal(expected)))
+		},
+		Entry("name", "TERM", syscall.SIGTERM, true),
+		Entry("name with prefix", "SIGQUIT", syscall.SIGQUIT, true),
+		Entry("lower case", "int", syscall.SIGINT, true),
+		Entry("sigdump signal", "CONT", syscall.SIGCONT, true),
+		Entry("unsupported", "KILL", syscall.Signal(0), false),
+	)
+
+	DescribeTable("ByteSize",
+		func(text string, expected ByteSize, valid bool) {
+			var size ByteSize
+			err := size.UnmarshalText([]byte(text))
+			if !valid {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).To(Equal(expected))
+		},
+		Entry("plain bytes", "1024", ByteSize(1024), true),
+		Entry("kibibytes", "2Ki", ByteSize(2048), true),
+		Entry("megabytes", "512MB", ByteSize(512<<20), true),
+		Entry("mebibytes with space", "512 MiB", ByteSize(512<<20), true),
+		Entry("gigabytes lower case", "1g", ByteSize(1<<30), true),
+		Entry("unknown unit", "1TB", ByteSize(0), false),
+		Entry("no number", "MB", ByteSize(0), false),
+	)
+
+	DescribeTable("Code",
+		func(text string, expected codes.Code, valid bool) {
+			var code Code
+			err := code.UnmarshalText([]byte(text))
+			if !valid {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal(Code(expected)))
+		},
+		Entry("name", "UNAVAILABLE", codes.Unavailable, true),
+		Entry("lower case", "deadline_exceeded", codes.DeadlineExceeded, true),
+		Entry("unknown", "BROKEN", codes.OK, false),
+	)
+
+	DescribeTable("Timeout",
+		func(text string, expected Timeout, valid bool) {
+			var timeout Timeout
+			err := timeout.UnmarshalText([]byte(text))
+			if !valid {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(timeout).To(Equal(expected))
+		},
+		Entry("duration", "30s", Timeout(30*time.Second), true),
+		Entry("none", "none", NoTimeout, true),
+		Entry("empty", "", Timeout(0), true),
+		Entry("negative", "-1s", Timeout(0), false),
+		Entry("malformed", "soon", Timeout(0), false),
+	)
 })
+
+func validRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Method:            "/users.Users/*",
+		MaxAttempts:       3,
+		RetryableCodes:    []Code{Code(codes.Unavailable)},
+		InitialBackoff:    50 * time.Millisecond,
+		MaxBackoff:        time.Second,
+		BackoffMultiplier: 2,
+	}
+}
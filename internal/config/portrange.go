@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxPort = 65535
+
+// PortRange is an inclusive range of TCP ports written as "9000-9099".
+// The zero value means that no range is configured.
+type PortRange [2]int
+
+func (r *PortRange) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*r = PortRange{}
+		return nil
+	}
+
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return fmt.Errorf("invalid port range %q: expected <first>-<last>", s)
+	}
+
+	first, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+
+	last, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+
+	if first <= 0 || last > maxPort || first > last {
+		return fmt.Errorf("invalid port range %q: ports must be ascending and between 1 and %d", s, maxPort)
+	}
+
+	*r = PortRange{first, last}
+	return nil
+}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First(), r.Last())
+}
+
+func (r PortRange) First() int {
+	return r[0]
+}
+
+func (r PortRange) Last() int {
+	return r[1]
+}
+
+func (r PortRange) IsZero() bool {
+	return r == PortRange{}
+}
+
+func (r PortRange) Size() int {
+	if r.IsZero() {
+		return 0
+	}
+	return r.Last() - r.First() + 1
+}
+
+func (r PortRange) Contains(port int) bool {
+	return port >= r.First() && port <= r.Last()
+}
+
+func (r PortRange) Overlaps(other PortRange) bool {
+	return r.First() <= other.Last() && other.First() <= r.Last()
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Signal is a process signal written by name, with or without the SIG prefix, e.g. "TERM" or "SIGQUIT".
+type Signal syscall.Signal
+
+var signalNames = map[string]syscall.Signal{
+	"CONT": syscall.SIGCONT,
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+func (s *Signal) UnmarshalText(text []byte) error {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(string(text))), "SIG")
+	sig, ok := signalNames[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q", text)
+	}
+
+	*s = Signal(sig)
+	return nil
+}
+
+func (s Signal) String() string {
+	return syscall.Signal(s).String()
+}
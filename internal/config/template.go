@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// WorkerVars holds the values available in workers.command and workers.env templates.
+type WorkerVars struct {
+	Name        string
+	Index       int
+	Addr        string
+	Port        int
+	MetricsPort int
+	MetricsPath string
+	PoolSize    int
+	// Dir is the resolved working directory of the worker process, empty for the directory of the relay.
+	Dir string
+
+	// Socket and MetricsSocket are set with the unix transport only.
+	Socket        string
+	MetricsSocket string
+
+	// NotifySocket is set when workers notify the relay about their readiness.
+	NotifySocket string
+}
+
+// RenderTemplate renders text as a Go template with the given worker variables.
+func RenderTemplate(text string, vars WorkerVars) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, vars); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", text, err)
+	}
+	return sb.String(), nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %q: %w", text, err)
+	}
+	return tmpl, nil
+}
+
+func validateTemplate(text string) error {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return err
+	}
+
+	// Every branch is checked for unknown fields, as executing against zero values
+	// skips the branches of conditions that are false for them.
+	if err := checkFields(tmpl.Root); err != nil {
+		return fmt.Errorf("invalid template %q: %w", text, err)
+	}
+	if err := tmpl.Execute(io.Discard, WorkerVars{}); err != nil {
+		return fmt.Errorf("invalid template %q: %w", text, err)
+	}
+	return nil
+}
+
+// checkFields walks the template tree and rejects references to fields that
+// WorkerVars does not have. The fields are plain values, so nested ones are unknown too.
+func checkFields(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkFields(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkFields(n.Pipe)
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return checkFields(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := checkFields(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := checkFields(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.ChainNode:
+		if err := checkFields(n.Node); err != nil {
+			return err
+		}
+		return fmt.Errorf("unknown field %q", strings.Join(n.Field, "."))
+	case *parse.FieldNode:
+		return checkIdent(n.Ident)
+	case *parse.VariableNode:
+		// Only $ refers to the worker variables, other variables hold plain values.
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			return checkIdent(n.Ident[1:])
+		}
+	}
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode) error {
+	for _, node := range []parse.Node{n.Pipe, n.List, n.ElseList} {
+		if err := checkFields(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkIdent(ident []string) error {
+	if _, ok := reflect.TypeFor[WorkerVars]().FieldByName(ident[0]); !ok || len(ident) > 1 {
+		return fmt.Errorf("unknown field %q", strings.Join(ident, "."))
+	}
+	return nil
+}
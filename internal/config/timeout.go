@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timeout is a duration that can also be written as "none" to disable the timeout.
+// The zero value means that the timeout is not set.
+type Timeout time.Duration
+
+// NoTimeout is a timeout written as "none".
+const NoTimeout Timeout = -1
+
+func (t *Timeout) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	switch s {
+	case "":
+		*t = 0
+	case "none":
+		*t = NoTimeout
+	default:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", s, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid timeout %q: must not be negative", s)
+		}
+		*t = Timeout(d)
+	}
+	return nil
+}
+
+// Duration returns the timeout, or zero when it is disabled or not set.
+func (t Timeout) Duration() time.Duration {
+	return max(time.Duration(t), 0)
+}
@@ -3,6 +3,7 @@ package healthcheck
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
 	"time"
@@ -10,38 +11,37 @@ import (
 	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/log"
 	"github.com/bibendi/gruf-relay/internal/worker"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
-type Balancer interface {
-	AddWorker(worker.Worker)
-	RemoveWorker(worker.Worker)
+type Manager interface {
+	GetWorkers() map[string]worker.Worker
 }
 
 type HealthCheckFunc func(ctx context.Context, w worker.Worker) (healthpb.HealthCheckResponse_ServingStatus, error)
 
+// Checker periodically checks the health of workers and reports the results to them.
+// Workers move between the ready and unhealthy states accordingly, which the
+// balancer and probes learn about from the worker events.
 type Checker struct {
-	workers       map[string]worker.Worker
-	lb            Balancer
+	m             Manager
 	interval      time.Duration
 	timeout       time.Duration
-	workerStates  map[string]connectivity.State
-	mu            sync.RWMutex
 	healthCheckFn HealthCheckFunc
 }
 
-func NewChecker(cfg config.HealthCheck, workers map[string]worker.Worker, lb Balancer, healthCheckFn HealthCheckFunc) *Checker {
+func NewChecker(cfg config.HealthCheck, m Manager, healthCheckFn HealthCheckFunc) *Checker {
 	if healthCheckFn == nil {
 		healthCheckFn = defaultHealthCheck
 	}
 
 	return &Checker{
-		workers:       workers,
-		lb:            lb,
+		m:             m,
 		interval:      cfg.Interval,
 		timeout:       cfg.Timeout,
-		workerStates:  make(map[string]connectivity.State),
 		healthCheckFn: healthCheckFn,
 	}
 }
@@ -63,77 +63,94 @@ func (c *Checker) Run(ctx context.Context) {
 	}
 }
 
-func (c *Checker) GetServerState(name string) connectivity.State {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	state, ok := c.workerStates[name]
-	if !ok {
-		return connectivity.Shutdown
-	}
-	return state
-}
-
 func (c *Checker) checkAll(ctx context.Context) {
+	workers := c.m.GetWorkers()
+
 	var wg sync.WaitGroup
-	for _, w := range c.workers {
+	for _, w := range workers {
 		wg.Add(1)
 		go func(w worker.Worker) {
 			defer wg.Done()
-			state := c.checkWorker(ctx, w)
-			c.updateWorkerState(w.String(), state)
+			c.CheckWorker(ctx, w)
 		}(w)
 	}
 
 	wg.Wait()
 }
 
-func (c *Checker) checkWorker(ctx context.Context, w worker.Worker) connectivity.State {
+// CheckWorker checks the worker right away and reports the result to it.
+func (c *Checker) CheckWorker(ctx context.Context, w worker.Worker) connectivity.State {
 	if !w.IsRunning() {
-		c.lb.RemoveWorker(w)
-		log.Error("Worker is not running", slog.Any("worker", w), slog.Any("state", connectivity.Shutdown))
-		return connectivity.Shutdown
+		log.Debug("Worker is not running, skipping health check", slog.Any("worker", w))
+		return connectivity.Connecting
+	}
+
+	// Workers with a notify socket report their readiness themselves.
+	if w.NotifySocket() != "" {
+		return notifiedState(w.Status().State)
+	}
+
+	// Failures are expected while the worker boots, it is killed when it does not become ready in time.
+	logFailure := log.Error
+	if w.Status().State == worker.StateBooting {
+		logFailure = log.Debug
 	}
 
 	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	status, err := c.healthCheckFn(checkCtx, w)
 	if err != nil {
-		c.lb.RemoveWorker(w)
-		log.Error("Health check failed", slog.Any("worker", w), slog.Any("error", err), slog.Any("state", connectivity.TransientFailure))
+		logFailure("Health check failed", slog.Any("worker", w), slog.Any("error", err), slog.Any("state", connectivity.TransientFailure))
+		// Timeouts of a running process hint at a hung worker, which is restarted by its watchdog.
+		if isTimeout(err) {
+			w.ReportTimeout()
+		} else {
+			w.ReportHealth(false, err.Error())
+		}
 		return connectivity.TransientFailure
 	}
 
-	var state connectivity.State
-	switch status {
-	case healthpb.HealthCheckResponse_SERVING:
-		state = connectivity.Ready
-		c.lb.AddWorker(w)
-	case healthpb.HealthCheckResponse_NOT_SERVING:
-		state = connectivity.TransientFailure
-		c.lb.RemoveWorker(w)
-	default:
-		state = connectivity.TransientFailure
-		c.lb.RemoveWorker(w)
+	if status != healthpb.HealthCheckResponse_SERVING {
+		logFailure("Worker is not serving", slog.Any("worker", w), slog.String("status", status.String()), slog.Any("state", connectivity.TransientFailure))
+		w.ReportHealth(false, status.String())
+		return connectivity.TransientFailure
+	}
+
+	w.ReportHealth(true, status.String())
+	// Crash looping workers are still checked, so that they finish booting, but are
+	// kept out of rotation until they are stable again.
+	if w.IsCrashLooping() {
+		log.Warn("Worker is healthy but crash looping", slog.Any("worker", w), slog.Any("state", connectivity.Shutdown))
+		return connectivity.Shutdown
 	}
 
-	log.Info("Worker is healthy", slog.Any("worker", w), slog.Any("state", state))
-	return state
+	log.Debug("Worker is healthy", slog.Any("worker", w))
+	return connectivity.Ready
 }
 
-func (c *Checker) updateWorkerState(name string, state connectivity.State) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.workerStates[name] = state
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded
+}
+
+// notifiedState maps the state of a worker that notifies its readiness to a connectivity state.
+func notifiedState(state worker.State) connectivity.State {
+	switch state {
+	case worker.StateReady:
+		return connectivity.Ready
+	case worker.StateUnhealthy:
+		return connectivity.TransientFailure
+	default:
+		return connectivity.Connecting
+	}
 }
 
 func defaultHealthCheck(ctx context.Context, w worker.Worker) (healthpb.HealthCheckResponse_ServingStatus, error) {
-	client, err := w.FetchClientConn(ctx)
+	conn, err := w.HealthCheckConn()
 	if err != nil {
 		return healthpb.HealthCheckResponse_UNKNOWN, err
 	}
-	defer client.Return()
 
-	healthClient := healthpb.NewHealthClient(client.Conn())
+	healthClient := healthpb.NewHealthClient(conn)
 	req := &healthpb.HealthCheckRequest{}
 	resp, err := healthClient.Check(ctx, req)
 	if err != nil {
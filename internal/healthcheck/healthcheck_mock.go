@@ -16,50 +16,40 @@ import (
 	gomock "go.uber.org/mock/gomock"
 )
 
-// MockBalancer is a mock of Balancer interface.
-type MockBalancer struct {
+// MockManager is a mock of Manager interface.
+type MockManager struct {
 	ctrl     *gomock.Controller
-	recorder *MockBalancerMockRecorder
+	recorder *MockManagerMockRecorder
 	isgomock struct{}
 }
 
-// MockBalancerMockRecorder is the mock recorder for MockBalancer.
-type MockBalancerMockRecorder struct {
-	mock *MockBalancer
+// MockManagerMockRecorder is the mock recorder for MockManager.
+type MockManagerMockRecorder struct {
+	mock *MockManager
 }
 
-// NewMockBalancer creates a new mock instance.
-func NewMockBalancer(ctrl *gomock.Controller) *MockBalancer {
-	mock := &MockBalancer{ctrl: ctrl}
-	mock.recorder = &MockBalancerMockRecorder{mock}
+// NewMockManager creates a new mock instance.
+func NewMockManager(ctrl *gomock.Controller) *MockManager {
+	mock := &MockManager{ctrl: ctrl}
+	mock.recorder = &MockManagerMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockBalancer) EXPECT() *MockBalancerMockRecorder {
+func (m *MockManager) EXPECT() *MockManagerMockRecorder {
 	return m.recorder
 }
 
-// AddWorker mocks base method.
-func (m *MockBalancer) AddWorker(arg0 worker.Worker) {
+// GetWorkers mocks base method.
+func (m *MockManager) GetWorkers() map[string]worker.Worker {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AddWorker", arg0)
+	ret := m.ctrl.Call(m, "GetWorkers")
+	ret0, _ := ret[0].(map[string]worker.Worker)
+	return ret0
 }
 
-// AddWorker indicates an expected call of AddWorker.
-func (mr *MockBalancerMockRecorder) AddWorker(arg0 any) *gomock.Call {
+// GetWorkers indicates an expected call of GetWorkers.
+func (mr *MockManagerMockRecorder) GetWorkers() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWorker", reflect.TypeOf((*MockBalancer)(nil).AddWorker), arg0)
-}
-
-// RemoveWorker mocks base method.
-func (m *MockBalancer) RemoveWorker(arg0 worker.Worker) {
-	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "RemoveWorker", arg0)
-}
-
-// RemoveWorker indicates an expected call of RemoveWorker.
-func (mr *MockBalancerMockRecorder) RemoveWorker(arg0 any) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveWorker", reflect.TypeOf((*MockBalancer)(nil).RemoveWorker), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkers", reflect.TypeOf((*MockManager)(nil).GetWorkers))
 }
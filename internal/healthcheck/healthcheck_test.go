@@ -11,8 +11,10 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -40,12 +42,8 @@ var _ = Describe("HealthCheck", func() {
 
 	Describe("NewChecker", func() {
 		It("should create a new health checker", func() {
-			workers := map[string]worker.Worker{
-				"worker-1": worker.NewMockWorker(ctrl),
-				"worker-2": worker.NewMockWorker(ctrl),
-			}
-			lb := NewMockBalancer(ctrl)
-			checker := NewChecker(cfg, workers, lb, nil)
+			m := NewMockManager(ctrl)
+			checker := NewChecker(cfg, m, nil)
 			Expect(checker).NotTo(BeNil())
 		})
 	})
@@ -54,12 +52,8 @@ var _ = Describe("HealthCheck", func() {
 		It("runs health checking", func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 			defer cancel()
-			workers := map[string]worker.Worker{
-				"worker-1": worker.NewMockWorker(ctrl),
-				"worker-2": worker.NewMockWorker(ctrl),
-			}
-			lb := NewMockBalancer(ctrl)
-			checker := NewChecker(cfg, workers, lb, nil)
+			m := NewMockManager(ctrl)
+			checker := NewChecker(cfg, m, nil)
 			Expect(func() {
 				checker.Run(ctx)
 			}).NotTo(Panic())
@@ -68,7 +62,7 @@ var _ = Describe("HealthCheck", func() {
 
 	Describe("checkAll", func() {
 		var (
-			lb            *MockBalancer
+			m             *MockManager
 			workerA       *worker.MockWorker
 			workers       map[string]worker.Worker
 			checker       *Checker
@@ -79,28 +73,68 @@ var _ = Describe("HealthCheck", func() {
 			workerA = worker.NewMockWorker(ctrl)
 			workers = map[string]worker.Worker{"worker-a": workerA}
 			workerA.EXPECT().String().Return("worker-a").AnyTimes()
-			lb = NewMockBalancer(ctrl)
+			workerA.EXPECT().NotifySocket().Return("").AnyTimes()
+			workerA.EXPECT().Status().Return(worker.Status{State: worker.StateReady}).AnyTimes()
+			m = NewMockManager(ctrl)
+			m.EXPECT().GetWorkers().DoAndReturn(func() map[string]worker.Worker {
+				return workers
+			}).AnyTimes()
 			healthcheckFn = func(ctx context.Context, w worker.Worker) (healthpb.HealthCheckResponse_ServingStatus, error) {
 				return healthpb.HealthCheckResponse_SERVING, nil
 			}
 		})
 
 		JustBeforeEach(func() {
-			checker = NewChecker(cfg, workers, lb, healthcheckFn)
+			checker = NewChecker(cfg, m, healthcheckFn)
 		})
 
-		It("updates state to ready when worker is healthy", func() {
+		It("reports a healthy worker", func() {
+			workerA.EXPECT().IsCrashLooping().Return(false)
 			workerA.EXPECT().IsRunning().Return(true)
-			lb.EXPECT().AddWorker(workerA)
+			workerA.EXPECT().ReportHealth(true, "SERVING")
 			checker.checkAll(context.Background())
-			Expect(checker.GetServerState(workerA.String())).To(Equal(connectivity.Ready))
 		})
 
-		It("updates state to shoutdown when worker is not running", func() {
+		It("skips a worker that is not running", func() {
 			workerA.EXPECT().IsRunning().Return(false)
-			lb.EXPECT().RemoveWorker(workerA)
-			checker.checkAll(context.Background())
-			Expect(checker.GetServerState(workerA.String())).To(Equal(connectivity.Shutdown))
+			Expect(checker.CheckWorker(context.Background(), workerA)).To(Equal(connectivity.Connecting))
+		})
+
+		It("checks a crash looping worker but keeps it out of rotation", func() {
+			workerA.EXPECT().IsRunning().Return(true)
+			workerA.EXPECT().ReportHealth(true, "SERVING")
+			workerA.EXPECT().IsCrashLooping().Return(true)
+			Expect(checker.CheckWorker(context.Background(), workerA)).To(Equal(connectivity.Shutdown))
+		})
+
+		Context("when not serving", func() {
+			BeforeEach(func() {
+				healthcheckFn = func(ctx context.Context, w worker.Worker) (healthpb.HealthCheckResponse_ServingStatus, error) {
+					return healthpb.HealthCheckResponse_NOT_SERVING, nil
+				}
+			})
+
+			It("reports an unhealthy worker", func() {
+				workerA.EXPECT().IsRunning().Return(true)
+				workerA.EXPECT().ReportHealth(false, "NOT_SERVING")
+
+				Expect(checker.CheckWorker(context.Background(), workerA)).To(Equal(connectivity.TransientFailure))
+			})
+		})
+
+		Context("when the health check times out", func() {
+			BeforeEach(func() {
+				healthcheckFn = func(ctx context.Context, w worker.Worker) (healthpb.HealthCheckResponse_ServingStatus, error) {
+					return healthpb.HealthCheckResponse_UNKNOWN, status.Error(codes.DeadlineExceeded, "context deadline exceeded")
+				}
+			})
+
+			It("reports a timeout to the worker", func() {
+				workerA.EXPECT().IsRunning().Return(true)
+				workerA.EXPECT().ReportTimeout()
+
+				Expect(checker.CheckWorker(context.Background(), workerA)).To(Equal(connectivity.TransientFailure))
+			})
 		})
 
 		Context("when grpc error", func() {
@@ -110,12 +144,11 @@ var _ = Describe("HealthCheck", func() {
 				}
 			})
 
-			It("updates state to transient failure when no connection", func() {
+			It("reports an unhealthy worker when no connection", func() {
 				workerA.EXPECT().IsRunning().Return(true)
-				lb.EXPECT().RemoveWorker(workerA)
+				workerA.EXPECT().ReportHealth(false, "no connection")
 
-				checker.checkAll(context.Background())
-				Expect(checker.GetServerState(workerA.String()).String()).To(Equal(connectivity.TransientFailure.String()))
+				Expect(checker.CheckWorker(context.Background(), workerA)).To(Equal(connectivity.TransientFailure))
 			})
 		})
 	})
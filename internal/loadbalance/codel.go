@@ -0,0 +1,32 @@
+package loadbalance
+
+import "time"
+
+// overloadDetector tells whether the request queue is overloaded the way CoDel does:
+// a queue that absorbs bursts drains within an interval, while a standing queue keeps
+// even its shortest wait above the target for a whole interval.
+type overloadDetector struct {
+	target      time.Duration
+	interval    time.Duration
+	intervalEnd time.Time
+	minSojourn  time.Duration
+	overloaded  bool
+}
+
+func newOverloadDetector(target, interval time.Duration) *overloadDetector {
+	return &overloadDetector{target: target, interval: interval}
+}
+
+// observe records the time a dispatched request waited in the queue.
+func (d *overloadDetector) observe(now time.Time, sojourn time.Duration) {
+	if now.Before(d.intervalEnd) {
+		d.minSojourn = min(d.minSojourn, sojourn)
+		return
+	}
+
+	if !d.intervalEnd.IsZero() {
+		d.overloaded = d.minSojourn > d.target
+	}
+	d.minSojourn = sojourn
+	d.intervalEnd = now.Add(d.interval)
+}
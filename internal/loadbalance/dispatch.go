@@ -0,0 +1,225 @@
+package loadbalance
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/worker"
+)
+
+var (
+	ErrQueueFull    = errors.New("request queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting in request queue")
+	ErrOverloaded   = errors.New("request queue is overloaded")
+)
+
+// QueueStats is a snapshot of the time dispatched requests waited in the queue.
+// Dispatched and WaitTime are cumulative, so callers compare consecutive snapshots.
+type QueueStats struct {
+	Dispatched int64
+	WaitTime   time.Duration
+}
+
+// waiter is a request waiting in the queue for a worker with a free connection.
+// A nil worker is sent when the request is shed.
+type waiter struct {
+	assigned   chan worker.Worker
+	enqueuedAt time.Time
+}
+
+// Dispatch assigns the request to a worker in rotation with a free connection and
+// pulls that connection. When every worker is busy, the request waits in a single
+// queue shared by all workers and goes to whichever worker frees a connection
+// first. Returning the connection frees the slot for the next request in the queue.
+func (lb *LoadBalancer) Dispatch(ctx context.Context) (worker.Worker, worker.PulledClientConn, error) {
+	w, err := lb.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The slot guarantees a free connection, as only dispatched requests take them.
+	conn, err := w.FetchClientConn()
+	if err != nil {
+		lb.release(w)
+		return nil, nil, err
+	}
+	return w, &dispatchedConn{PulledClientConn: conn, lb: lb, worker: w}, nil
+}
+
+// acquire takes a slot of a worker, waiting in the queue if there is none free or
+// other requests are already waiting.
+func (lb *LoadBalancer) acquire(ctx context.Context) (worker.Worker, error) {
+	if err := ctx.Err(); err != nil {
+		recordGiveUp(err)
+		return nil, err
+	}
+
+	lb.mu.Lock()
+	if len(lb.waiters) == 0 {
+		if w := lb.pick(); w != nil {
+			lb.inFlight[w.String()]++
+			lb.detector.observe(time.Now(), 0)
+			lb.mu.Unlock()
+			lb.recordSojourn(0)
+			return w, nil
+		}
+	}
+	if lb.queue.MaxDepth > 0 && len(lb.waiters) >= lb.queue.MaxDepth {
+		lb.mu.Unlock()
+		requestsShedTotal.WithLabelValues(shedQueueFull).Inc()
+		return nil, ErrQueueFull
+	}
+	wt := &waiter{assigned: make(chan worker.Worker, 1), enqueuedAt: time.Now()}
+	lb.waiters = append(lb.waiters, wt)
+	queueDepth.Set(float64(len(lb.waiters)))
+	lb.mu.Unlock()
+
+	timer := time.NewTimer(lb.queue.Timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case w := <-wt.assigned:
+		if w == nil {
+			requestsShedTotal.WithLabelValues(shedOverload).Inc()
+			return nil, ErrOverloaded
+		}
+		lb.recordSojourn(time.Since(wt.enqueuedAt))
+		return w, nil
+	case <-timer.C:
+		requestsShedTotal.WithLabelValues(shedTimeout).Inc()
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+		recordGiveUp(err)
+	}
+
+	lb.mu.Lock()
+	if i := slices.Index(lb.waiters, wt); i >= 0 {
+		lb.waiters = slices.Delete(lb.waiters, i, i+1)
+		queueDepth.Set(float64(len(lb.waiters)))
+		lb.mu.Unlock()
+		return nil, err
+	}
+	lb.mu.Unlock()
+
+	// The request was assigned while giving up, so its slot goes to the next one.
+	if w := <-wt.assigned; w != nil {
+		lb.release(w)
+	}
+	return nil, err
+}
+
+// recordSojourn accounts the time a dispatched request waited in the queue.
+func (lb *LoadBalancer) recordSojourn(sojourn time.Duration) {
+	queueSojourn.Observe(sojourn.Seconds())
+	lb.dispatched.Add(1)
+	lb.waitTime.Add(int64(sojourn))
+}
+
+// QueueStats reports how long dispatched requests waited in the queue.
+func (lb *LoadBalancer) QueueStats() QueueStats {
+	return QueueStats{
+		Dispatched: lb.dispatched.Load(),
+		WaitTime:   time.Duration(lb.waitTime.Load()),
+	}
+}
+
+// recordGiveUp counts requests whose deadline ran out before they were dispatched.
+func recordGiveUp(err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		requestsShedTotal.WithLabelValues(shedDeadline).Inc()
+	}
+}
+
+// release frees a slot of the worker and hands free slots to waiting requests.
+func (lb *LoadBalancer) release(w worker.Worker) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	name := w.String()
+	if lb.inFlight[name]--; lb.inFlight[name] <= 0 {
+		delete(lb.inFlight, name)
+	}
+	lb.assign()
+}
+
+// assign hands free slots to the waiting requests in the order of the queue
+// discipline. The caller must hold lb.mu.
+func (lb *LoadBalancer) assign() {
+	defer func() {
+		queueDepth.Set(float64(len(lb.waiters)))
+	}()
+
+	for len(lb.waiters) > 0 {
+		w := lb.pick()
+		if w == nil {
+			return
+		}
+		wt := lb.dequeue(time.Now())
+		if wt == nil {
+			return
+		}
+		lb.inFlight[w.String()]++
+		wt.assigned <- w
+	}
+}
+
+// dequeue takes the next request off the queue. FIFO serves the oldest request.
+// While the queue is overloaded, CoDel sheds requests that waited longer than the
+// target, so that a standing queue drains, and adaptive LIFO serves the newest
+// request first, as it still has the most of its deadline left. The caller must
+// hold lb.mu.
+func (lb *LoadBalancer) dequeue(now time.Time) *waiter {
+	for len(lb.waiters) > 0 {
+		i := 0
+		if lb.queue.Discipline == config.QueueAdaptiveLIFO && lb.detector.overloaded {
+			i = len(lb.waiters) - 1
+		}
+		wt := lb.waiters[i]
+		lb.waiters = slices.Delete(lb.waiters, i, i+1)
+
+		sojourn := now.Sub(wt.enqueuedAt)
+		if lb.queue.Discipline == config.QueueCoDel && lb.detector.overloaded && sojourn > lb.queue.Target {
+			wt.assigned <- nil
+			continue
+		}
+		lb.detector.observe(now, sojourn)
+		return wt
+	}
+	return nil
+}
+
+// pick returns the next worker in rotation with a free slot, going round-robin
+// so that idle workers share the load. The caller must hold lb.mu.
+func (lb *LoadBalancer) pick() worker.Worker {
+	workers := lb.workers.Load().([]worker.Worker)
+	n := len(workers)
+	for range n {
+		lb.nextIndex++
+		w := workers[lb.nextIndex%uint64(n)]
+		if lb.inFlight[w.String()] < w.PoolStats().Size {
+			return w
+		}
+	}
+	return nil
+}
+
+// dispatchedConn frees the slot of the worker once the connection is returned.
+type dispatchedConn struct {
+	worker.PulledClientConn
+	lb     *LoadBalancer
+	worker worker.Worker
+	once   sync.Once
+}
+
+func (c *dispatchedConn) Return() {
+	c.once.Do(func() {
+		c.PulledClientConn.Return()
+		c.lb.release(c.worker)
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 	"slices"
 
+	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/log"
 	"github.com/bibendi/gruf-relay/internal/worker"
 )
@@ -15,16 +16,35 @@ import (
 type LoadBalancer struct {
 	addChan     chan worker.Worker
 	removeChan  chan worker.Worker
+	swapChan    chan swap
+	done        chan struct{}
 	workers     atomic.Value
 	workerNames map[string]bool
 	mu          sync.Mutex
 	nextIndex   uint64
+	queue       config.Queue
+	waiters     []*waiter
+	inFlight    map[string]int
+	detector    *overloadDetector
+	dispatched  atomic.Int64
+	waitTime    atomic.Int64
 }
 
-func NewLoadBalancer() *LoadBalancer {
+// swap replaces a set of workers in rotation with another one in a single step.
+type swap struct {
+	add    []worker.Worker
+	remove []worker.Worker
+}
+
+func NewLoadBalancer(cfg config.Queue) *LoadBalancer {
 	lb := &LoadBalancer{
+		queue:       cfg,
+		inFlight:    make(map[string]int),
+		detector:    newOverloadDetector(cfg.Target, cfg.Interval),
 		addChan:     make(chan worker.Worker),
 		removeChan:  make(chan worker.Worker),
+		swapChan:    make(chan swap),
+		done:        make(chan struct{}),
 		workerNames: make(map[string]bool),
 	}
 	lb.workers.Store([]worker.Worker{})
@@ -33,6 +53,7 @@ func NewLoadBalancer() *LoadBalancer {
 
 func (lb *LoadBalancer) Run(ctx context.Context) {
 	log.Info("Starting load balancer")
+	defer close(lb.done)
 
 	for {
 		select {
@@ -40,6 +61,8 @@ func (lb *LoadBalancer) Run(ctx context.Context) {
 			lb.onAddWorker(w)
 		case w := <-lb.removeChan:
 			lb.onRemoveWorker(w)
+		case s := <-lb.swapChan:
+			lb.onSwap(s)
 		case <-ctx.Done():
 			log.Info("Stopping load balancer")
 			return
@@ -48,23 +71,37 @@ func (lb *LoadBalancer) Run(ctx context.Context) {
 }
 
 func (lb *LoadBalancer) AddWorker(w worker.Worker) {
-	lb.addChan <- w
+	select {
+	case lb.addChan <- w:
+	case <-lb.done:
+	}
 }
 
 func (lb *LoadBalancer) RemoveWorker(w worker.Worker) {
-	lb.removeChan <- w
+	select {
+	case lb.removeChan <- w:
+	case <-lb.done:
+	}
 }
 
-func (lb *LoadBalancer) Next() worker.Worker {
-	workers := lb.workers.Load().([]worker.Worker)
-
-	n := uint64(len(workers))
-	if n == 0 {
-		return nil
+// Swap takes the remove workers out of rotation and puts the add workers in at once,
+// so that no request is routed to a mix of both or to none of them.
+func (lb *LoadBalancer) Swap(add, remove []worker.Worker) {
+	select {
+	case lb.swapChan <- swap{add: add, remove: remove}:
+	case <-lb.done:
 	}
+}
 
-	next := atomic.AddUint64(&lb.nextIndex, 1) % n
-	return workers[next]
+// HandleEvent keeps only ready workers in rotation as they change their state.
+// Spares stay out of rotation until they are promoted, and crash looping workers
+// until they are stable again.
+func (lb *LoadBalancer) HandleEvent(e worker.Event) {
+	if e.Status.State == worker.StateReady && !e.Status.Spare && !e.Status.CrashLooping {
+		lb.AddWorker(e.Worker)
+		return
+	}
+	lb.RemoveWorker(e.Worker)
 }
 
 func (lb *LoadBalancer) onAddWorker(w worker.Worker) {
@@ -78,6 +115,7 @@ func (lb *LoadBalancer) onAddWorker(w worker.Worker) {
 	currentWorkers := lb.workers.Load().([]worker.Worker)
 	lb.workers.Store(append(currentWorkers, w))
 	lb.workerNames[w.String()] = true
+	lb.assign()
 }
 
 func (lb *LoadBalancer) onRemoveWorker(w worker.Worker) {
@@ -99,3 +137,24 @@ func (lb *LoadBalancer) onRemoveWorker(w worker.Worker) {
 	delete(lb.workerNames, w.String())
 	lb.workers.Store(newWorkers)
 }
+
+func (lb *LoadBalancer) onSwap(s swap) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	log.Debug("Swapping workers in load balancer", slog.Any("add", s.add), slog.Any("remove", s.remove))
+	for _, w := range s.remove {
+		delete(lb.workerNames, w.String())
+	}
+	newWorkers := slices.DeleteFunc(slices.Clone(lb.workers.Load().([]worker.Worker)), func(w worker.Worker) bool {
+		return !lb.workerNames[w.String()]
+	})
+	for _, w := range s.add {
+		if !lb.workerNames[w.String()] {
+			newWorkers = append(newWorkers, w)
+			lb.workerNames[w.String()] = true
+		}
+	}
+	lb.workers.Store(newWorkers)
+	lb.assign()
+}
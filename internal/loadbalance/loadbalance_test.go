@@ -5,10 +5,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/worker"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -18,12 +20,18 @@ func TestHealthCheck(t *testing.T) {
 
 var _ = Describe("LoadBalance", func() {
 	var (
-		ctrl *gomock.Controller
-		lb   *LoadBalancer
+		ctrl  *gomock.Controller
+		lb    *LoadBalancer
+		queue config.Queue
 	)
 
+	rotation := func() []worker.Worker {
+		return lb.workers.Load().([]worker.Worker)
+	}
+
 	BeforeEach(func() {
 		ctrl = gomock.NewController(GinkgoT())
+		queue = config.Queue{Timeout: time.Second}
 
 		DeferCleanup(func() {
 			ctrl.Finish()
@@ -31,7 +39,7 @@ var _ = Describe("LoadBalance", func() {
 	})
 
 	JustBeforeEach(func() {
-		lb = NewLoadBalancer()
+		lb = NewLoadBalancer(queue)
 	})
 
 	Describe("NewLoadBalancer", func() {
@@ -69,14 +77,310 @@ var _ = Describe("LoadBalance", func() {
 		It("adds and removes worker", func() {
 			go lb.Run(ctx)
 			lb.AddWorker(wrk)
-			time.Sleep(10 * time.Millisecond)
-			nextWorker := lb.Next()
-			Expect(nextWorker).NotTo(BeNil())
-			Expect(nextWorker).To(Equal(wrk))
+			Eventually(rotation).Should(Equal([]worker.Worker{wrk}))
 			lb.RemoveWorker(wrk)
-			time.Sleep(10 * time.Millisecond)
-			nextWorker = lb.Next()
-			Expect(nextWorker).To(BeNil())
+			Eventually(rotation).Should(BeEmpty())
+		})
+
+		It("follows the state of workers", func() {
+			go lb.Run(ctx)
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateBooting, Status: worker.Status{State: worker.StateReady}})
+			Eventually(rotation).Should(Equal([]worker.Worker{wrk}))
+
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateReady, Status: worker.Status{State: worker.StateDraining}})
+			Eventually(rotation).Should(BeEmpty())
+		})
+
+		It("keeps spares out of rotation until they are promoted", func() {
+			go lb.Run(ctx)
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateBooting, Status: worker.Status{State: worker.StateReady, Spare: true}})
+			Consistently(rotation, 50*time.Millisecond).Should(BeEmpty())
+
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateReady, Status: worker.Status{State: worker.StateReady}})
+			Eventually(rotation).Should(Equal([]worker.Worker{wrk}))
+
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateReady, Status: worker.Status{State: worker.StateReady, Spare: true}})
+			Eventually(rotation).Should(BeEmpty())
+		})
+
+		It("keeps crash looping workers out of rotation until they are stable", func() {
+			go lb.Run(ctx)
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateBooting, Status: worker.Status{State: worker.StateReady, CrashLooping: true}})
+			Consistently(rotation, 50*time.Millisecond).Should(BeEmpty())
+
+			lb.HandleEvent(worker.Event{Worker: wrk, From: worker.StateReady, Status: worker.Status{State: worker.StateReady}})
+			Eventually(rotation).Should(Equal([]worker.Worker{wrk}))
+		})
+
+		It("swaps workers in rotation at once", func() {
+			blue := worker.NewMockWorker(ctrl)
+			blue.EXPECT().String().Return("worker-blue").AnyTimes()
+			green := worker.NewMockWorker(ctrl)
+			green.EXPECT().String().Return("worker-green").AnyTimes()
+
+			go lb.Run(ctx)
+			lb.AddWorker(wrk)
+			lb.AddWorker(blue)
+			lb.Swap([]worker.Worker{green}, []worker.Worker{wrk, blue})
+
+			Eventually(rotation).Should(Equal([]worker.Worker{green}))
+		})
+
+		It("does not block callers after it is stopped", func() {
+			runCtx, runCancel := context.WithCancel(ctx)
+			stopped := make(chan struct{})
+			go func() {
+				lb.Run(runCtx)
+				close(stopped)
+			}()
+			runCancel()
+			Eventually(stopped).Should(BeClosed())
+
+			done := make(chan struct{})
+			go func() {
+				lb.AddWorker(wrk)
+				lb.RemoveWorker(wrk)
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Describe("Dispatch", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+
+		newWorker := func(name string, size int) *worker.MockWorker {
+			w := worker.NewMockWorker(ctrl)
+			w.EXPECT().String().Return(name).AnyTimes()
+			w.EXPECT().PoolStats().Return(worker.PoolStats{Size: size}).AnyTimes()
+			w.EXPECT().FetchClientConn().DoAndReturn(func() (worker.PulledClientConn, error) {
+				return &testConn{}, nil
+			}).AnyTimes()
+			return w
+		}
+
+		queued := func() int {
+			lb.mu.Lock()
+			defer lb.mu.Unlock()
+			return len(lb.waiters)
+		}
+
+		// dispatch runs Dispatch in the background and waits until the request is queued.
+		dispatch := func() chan dispatched {
+			depth := queued()
+			result := make(chan dispatched, 1)
+			go func() {
+				w, conn, err := lb.Dispatch(ctx)
+				result <- dispatched{Worker: w, Conn: conn, Err: err}
+			}()
+			Eventually(queued).Should(Equal(depth + 1))
+			return result
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			DeferCleanup(func() {
+				cancel()
+			})
+		})
+
+		JustBeforeEach(func() {
+			go lb.Run(ctx)
+		})
+
+		It("assigns requests to workers with free connections", func() {
+			w1 := newWorker("worker-1", 1)
+			w2 := newWorker("worker-2", 1)
+			lb.AddWorker(w1)
+			lb.AddWorker(w2)
+			Eventually(rotation).Should(HaveLen(2))
+
+			_, first, err := lb.Dispatch(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			_, second, err := lb.Dispatch(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lb.inFlight).To(Equal(map[string]int{"worker-1": 1, "worker-2": 1}))
+
+			first.Return()
+			second.Return()
+			Expect(lb.inFlight).To(BeEmpty())
+		})
+
+		It("queues requests in order until a worker frees a connection", func() {
+			w1 := newWorker("worker-1", 1)
+			w2 := newWorker("worker-2", 1)
+			lb.AddWorker(w1)
+			lb.AddWorker(w2)
+			Eventually(rotation).Should(HaveLen(2))
+
+			_, busy1, err := lb.Dispatch(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			got, busy2, err := lb.Dispatch(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			first := dispatch()
+			second := dispatch()
+			Consistently(first, 50*time.Millisecond).ShouldNot(Receive())
+
+			busy2.Return()
+			Eventually(first).Should(Receive(HaveField("Worker", got)))
+			Consistently(second, 50*time.Millisecond).ShouldNot(Receive())
+
+			busy1.Return()
+			Eventually(second).Should(Receive(HaveField("Err", BeNil())))
+
+			stats := lb.QueueStats()
+			Expect(stats.Dispatched).To(Equal(int64(4)))
+			Expect(stats.WaitTime).To(BeNumerically(">=", 150*time.Millisecond))
+		})
+
+		It("queues requests until a worker joins the rotation", func() {
+			assigned := dispatch()
+			Consistently(assigned, 50*time.Millisecond).ShouldNot(Receive())
+
+			w1 := newWorker("worker-1", 1)
+			lb.AddWorker(w1)
+			Eventually(assigned).Should(Receive(HaveField("Worker", w1)))
+		})
+
+		Context("with a max depth", func() {
+			BeforeEach(func() {
+				queue.MaxDepth = 1
+			})
+
+			It("rejects requests when the queue is full", func() {
+				dispatch()
+
+				_, _, err := lb.Dispatch(ctx)
+				Expect(err).To(MatchError(ErrQueueFull))
+			})
+		})
+
+		Context("with a short queue timeout", func() {
+			BeforeEach(func() {
+				queue.Timeout = 20 * time.Millisecond
+			})
+
+			It("gives up waiting after the timeout", func() {
+				_, _, err := lb.Dispatch(ctx)
+				Expect(err).To(MatchError(ErrQueueTimeout))
+				Expect(queued()).To(BeZero())
+			})
+		})
+
+		Context("under sustained overload", func() {
+			var (
+				w1   *worker.MockWorker
+				busy worker.PulledClientConn
+			)
+
+			// overload keeps the only slot busy while a request waits past the target,
+			// and returns the connection of that request.
+			overload := func() worker.PulledClientConn {
+				waiting := dispatch()
+				time.Sleep(30 * time.Millisecond)
+				busy.Return()
+
+				var res dispatched
+				Eventually(waiting).Should(Receive(&res))
+				Expect(res.Err).NotTo(HaveOccurred())
+				return res.Conn
+			}
+
+			BeforeEach(func() {
+				queue.Target = time.Millisecond
+				queue.Interval = 10 * time.Millisecond
+			})
+
+			JustBeforeEach(func() {
+				w1 = newWorker("worker-1", 1)
+				lb.AddWorker(w1)
+				Eventually(rotation).Should(HaveLen(1))
+
+				var err error
+				_, busy, err = lb.Dispatch(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				busy = overload()
+			})
+
+			Context("with the codel discipline", func() {
+				BeforeEach(func() {
+					queue.Discipline = config.QueueCoDel
+				})
+
+				It("sheds requests that waited longer than the target", func() {
+					first := dispatch()
+					second := dispatch()
+					time.Sleep(30 * time.Millisecond)
+
+					busy.Return()
+					var res dispatched
+					Eventually(first).Should(Receive(&res))
+					Expect(res.Err).NotTo(HaveOccurred())
+
+					res.Conn.Return()
+					Eventually(second).Should(Receive(HaveField("Err", MatchError(ErrOverloaded))))
+				})
+			})
+
+			Context("with the adaptive_lifo discipline", func() {
+				BeforeEach(func() {
+					queue.Discipline = config.QueueAdaptiveLIFO
+				})
+
+				It("serves the newest request first", func() {
+					first := dispatch()
+					second := dispatch()
+					third := dispatch()
+					time.Sleep(30 * time.Millisecond)
+
+					busy.Return()
+					var res dispatched
+					Eventually(first).Should(Receive(&res))
+
+					res.Conn.Return()
+					Eventually(third).Should(Receive(HaveField("Err", BeNil())))
+					Consistently(second, 50*time.Millisecond).ShouldNot(Receive())
+				})
+			})
+		})
+
+		It("does not dispatch requests whose deadline has run out", func() {
+			lb.AddWorker(newWorker("worker-1", 1))
+			Eventually(rotation).Should(HaveLen(1))
+
+			reqCtx, reqCancel := context.WithDeadline(ctx, time.Now())
+			defer reqCancel()
+
+			_, _, err := lb.Dispatch(reqCtx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(lb.inFlight).To(BeEmpty())
+		})
+
+		It("leaves the queue when the request is cancelled", func() {
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			reqCancel()
+
+			_, _, err := lb.Dispatch(reqCtx)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(queued()).To(BeZero())
 		})
 	})
 })
+
+type dispatched struct {
+	Worker worker.Worker
+	Conn   worker.PulledClientConn
+	Err    error
+}
+
+type testConn struct{}
+
+func (c *testConn) Conn() *grpc.ClientConn {
+	return nil
+}
+
+func (c *testConn) Return() {}
@@ -0,0 +1,31 @@
+package loadbalance
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	shedQueueFull = "queue_full"
+	shedOverload  = "overload"
+	shedTimeout   = "timeout"
+	shedDeadline  = "deadline"
+)
+
+var (
+	requestsShedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_requests_shed_total",
+		Help: "Total number of requests rejected by the request queue by reason.",
+	}, []string{"reason"})
+
+	queueSojourn = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gruf_relay_queue_sojourn_seconds",
+		Help:    "Time requests waited in the request queue before they were dispatched to a worker.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gruf_relay_queue_depth",
+		Help: "Number of requests waiting in the request queue.",
+	})
+)
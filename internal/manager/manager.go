@@ -1,78 +1,690 @@
+//go:generate mockgen -source=manager.go -destination=manager_mock.go -package=manager
 package manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"os"
+	"slices"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/log"
 	"github.com/bibendi/gruf-relay/internal/worker"
+	"google.golang.org/grpc/connectivity"
 )
 
+var (
+	ErrAllWorkersCrashLooping   = errors.New("all workers are crash looping")
+	ErrRollingRestartInProgress = errors.New("rolling restart is already in progress")
+	ErrReloadInProgress         = errors.New("reload is already in progress")
+	ErrNotRunning               = errors.New("manager is not running")
+	ErrMinWorkers               = errors.New("minimum number of workers reached")
+	ErrMaxWorkers               = errors.New("maximum number of workers reached")
+	ErrNoFreePorts              = errors.New("no free ports left for another worker")
+)
+
+const crashLoopCheckInterval = time.Second
+
+type HealthChecker interface {
+	CheckWorker(ctx context.Context, w worker.Worker) connectivity.State
+}
+
+// Balancer routes requests to the active workers.
+type Balancer interface {
+	Swap(add, remove []worker.Worker)
+}
+
 type Manager struct {
-	workers map[string]worker.Worker
+	workers         map[string]worker.Worker
+	slots           map[string]workerSlot
+	handles         map[string]*workerHandle
+	ports           *portAllocator
+	unixSockets     bool
+	portRange       config.PortRange
+	metricsRange    config.PortRange
+	newWorker       func(slot workerSlot, dir string) worker.Worker
+	mu              sync.RWMutex
+	runCtx          context.Context
+	errChan         chan error
+	wg              sync.WaitGroup
+	minWorkers      int
+	maxWorkers      int
+	exitOnCrashLoop bool
+	rollingRestart  config.RollingRestart
+	reload          config.Reload
+	restartMu       sync.Mutex
+	restarting      error
+	dir             string
+	workDir         string
+	generation      int
+	generations     map[string]int
+	spares          map[string]bool
+	vacatedMu       sync.Mutex
+	vacated         []string
+	vacatedChan     chan struct{}
+}
+
+// workerSlot is the position and the ports taken by a worker.
+type workerSlot struct {
+	index       int
+	port        int
+	metricsPort int
+}
+
+// WorkerInfo describes a managed worker for introspection.
+type WorkerInfo struct {
+	Name        string `json:"name"`
+	Index       int    `json:"index"`
+	Addr        string `json:"addr"`
+	Port        int    `json:"port,omitempty"`
+	MetricsPort int    `json:"metrics_port,omitempty"`
+	Running     bool   `json:"running"`
+	State       string `json:"state"`
+	Restarts    int    `json:"restarts"`
+	Message     string `json:"message,omitempty"`
+	Spare       bool   `json:"spare,omitempty"`
+	Generation  int    `json:"generation,omitempty"`
+}
+
+// workerHandle stops a single worker started by the manager.
+type workerHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
-func NewManager(cfg config.Workers) *Manager {
-	workers := make(map[string]worker.Worker, cfg.Count)
+// NewManager creates the initial workers on free ports, never taking the
+// reserved ports the relay listens on itself. Workers publish their state
+// transitions on the events bus. The spares are started after the active
+// workers and kept out of rotation until an active worker leaves it.
+func NewManager(cfg config.Workers, events *worker.EventBus, reservedPorts map[string]int) (*Manager, error) {
+	m := &Manager{
+		workers:         make(map[string]worker.Worker, cfg.Count),
+		slots:           make(map[string]workerSlot, cfg.Count),
+		handles:         make(map[string]*workerHandle, cfg.Count),
+		ports:           newPortAllocator(reservedPorts),
+		unixSockets:     cfg.Transport == config.TransportUnix,
+		portRange:       cfg.Ports(),
+		metricsRange:    cfg.MetricsPorts(),
+		minWorkers:      max(cfg.Min, 1),
+		maxWorkers:      cfg.Max,
+		exitOnCrashLoop: cfg.Restart.ExitOnCrashLoop,
+		rollingRestart:  cfg.RollingRestart,
+		reload:          cfg.Reload,
+		dir:             cfg.Dir,
+		generations:     make(map[string]int, cfg.Count+cfg.Spares),
+		spares:          make(map[string]bool, cfg.Spares),
+		vacatedChan:     make(chan struct{}, 1),
+		newWorker: func(slot workerSlot, dir string) worker.Worker {
+			opts := []worker.Option{
+				worker.WithIndex(slot.index),
+				worker.WithCommand(cfg.Command, cfg.Env),
+				worker.WithRestartPolicy(cfg.Restart),
+				worker.WithMaxRequests(cfg.MaxRequests, cfg.MaxRequestsJitter),
+				worker.WithRSSSampling(cfg.RSSInterval, cfg.RSSIncludeChildren),
+				worker.WithMaxRSS(int64(cfg.MaxRSS), cfg.MaxRSSDuration),
+				worker.WithEvents(events),
+				worker.WithBootTimeout(cfg.BootTimeout),
+				worker.WithShutdown(cfg.DrainTimeout, cfg.ShutdownTimeout, syscall.Signal(cfg.StopSignal)),
+				worker.WithCrashReports(cfg.CrashReports.OutputLines, cfg.CrashReports.Keep),
+				worker.WithHangWatchdog(cfg.Watchdog.Timeouts, syscall.Signal(cfg.Watchdog.DumpSignal), cfg.Watchdog.DumpTimeout),
+			}
+			if cfg.Transport == config.TransportUnix {
+				opts = append(opts, worker.WithUnixSocket(cfg.SocketDir))
+			}
+			if dir != "" {
+				opts = append(opts, worker.WithDir(dir))
+			}
+			if cfg.Output.Mode == config.OutputLog {
+				opts = append(opts, worker.WithOutputLogging(int(cfg.Output.MaxLineLength)))
+			}
+			if cfg.Notify.Enabled {
+				opts = append(opts, worker.WithNotifySocket(cfg.SocketDir, cfg.Notify.WatchdogTimeout))
+			}
+			return worker.NewWorker(workerName(slot.index), slot.port, slot.metricsPort, cfg.MetricsPath, cfg.PoolSize, opts...)
+		},
+	}
 
-	for i := range cfg.Count {
-		name := fmt.Sprintf("worker-%d", i+1)
-		port := cfg.StartPort + i
-		metricsPort := port + 100
-		workers[name] = worker.NewWorker(name, port, metricsPort, cfg.MetricsPath, cfg.PoolSize)
+	if m.unixSockets || cfg.Notify.Enabled {
+		if err := os.MkdirAll(cfg.SocketDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create socket directory: %w", err)
+		}
 	}
 
-	return &Manager{
-		workers: workers,
+	workDir, err := m.resolveDir()
+	if err != nil {
+		return nil, err
 	}
+	m.workDir = workDir
+
+	for i := range cfg.Count + cfg.Spares {
+		name, w, err := m.addWorker(i, m.workDir)
+		if err != nil {
+			return nil, err
+		}
+		if i >= cfg.Count {
+			m.spares[name] = true
+			w.SetSpare(true)
+		}
+	}
+
+	if cfg.Spares > 0 && events != nil {
+		events.Subscribe(m.handleEvent)
+	}
+
+	return m, nil
+}
+
+func workerName(index int) string {
+	return fmt.Sprintf("worker-%d", index+1)
 }
 
 func (m *Manager) Run(ctx context.Context) error {
-	var wg sync.WaitGroup
+	errCtx, cancel := context.WithCancel(ctx)
+	m.errChan = make(chan error, 1)
 
-	log.Info("Starting manager", slog.Int("workers_count", len(m.workers)))
-	errChan := make(chan error, 1)
-	defer close(errChan)
+	m.mu.Lock()
+	log.Info("Starting manager", slog.Int("workers_count", m.activeCount()), slog.Int("spares_count", len(m.spares)))
+	m.runCtx = errCtx
+	for name, w := range m.workers {
+		m.runWorker(name, w, m.fail)
+	}
+	m.mu.Unlock()
 
-	errCtx, cancel := context.WithCancel(ctx)
+	err := m.wait(ctx, m.errChan)
 
-	for _, w := range m.workers {
-		wg.Add(1)
-		go func(w worker.Worker) {
-			defer wg.Done()
-			if err := w.Run(errCtx); err != nil {
-				select {
-				case errChan <- err:
-					log.Error("Failed to run worker", slog.Any("error", err), slog.Any("worker", w))
-				default:
-				}
+	m.mu.Lock()
+	cancel()
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	return err
+}
+
+// runWorker starts the worker in the background and passes the error it fails with,
+// such as a process that could not be spawned, to onError once it has stopped.
+// The caller must hold m.mu.
+func (m *Manager) runWorker(name string, w worker.Worker, onError func(error)) {
+	ctx, cancel := context.WithCancel(m.runCtx)
+	handle := &workerHandle{cancel: cancel, done: make(chan struct{})}
+	m.handles[name] = handle
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := w.Run(ctx)
+		close(handle.done)
+		if err != nil {
+			log.Error("Failed to run worker", slog.Any("error", err), slog.Any("worker", w))
+			onError(err)
+		}
+	}()
+}
+
+// fail stops the manager with the error of a worker started along with it.
+func (m *Manager) fail(err error) {
+	select {
+	case m.errChan <- err:
+	default:
+	}
+}
+
+// removeFailed takes a worker added at runtime that failed out of the membership
+// and releases its slot, as the relay keeps running without it.
+func (m *Manager) removeFailed(name string, w worker.Worker) {
+	m.mu.Lock()
+	if m.workers[name] != w {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.workers, name)
+	delete(m.handles, name)
+	delete(m.spares, name)
+	m.mu.Unlock()
+
+	m.releaseSlot(name)
+	log.Warn("Worker removed after it failed", slog.Any("worker", w))
+}
+
+func (m *Manager) wait(ctx context.Context, errChan <-chan error) error {
+	var crashLoopCheck <-chan time.Time
+	if m.exitOnCrashLoop {
+		ticker := time.NewTicker(crashLoopCheckInterval)
+		defer ticker.Stop()
+		crashLoopCheck = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-errChan:
+			return err
+		case <-ctx.Done():
+			return nil
+		case <-m.vacatedChan:
+			m.promoteSpares()
+		case <-crashLoopCheck:
+			if m.allCrashLooping() {
+				log.Error("All workers are crash looping, giving up")
+				return ErrAllWorkersCrashLooping
 			}
-		}(w)
+		}
+	}
+}
+
+func (m *Manager) allCrashLooping() bool {
+	workers := m.GetWorkers()
+	for _, w := range workers {
+		if !w.IsCrashLooping() {
+			return false
+		}
+	}
+	return len(workers) > 0
+}
+
+// GetWorkers returns a snapshot of the workers, which may change at runtime.
+func (m *Manager) GetWorkers() map[string]worker.Worker {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return maps.Clone(m.workers)
+}
+
+func (m *Manager) GetWorkerNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Collect(maps.Keys(m.workers))
+}
+
+// ListWorkers describes the workers ordered by index.
+func (m *Manager) ListWorkers() []WorkerInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]WorkerInfo, 0, len(m.workers))
+	for name, w := range m.workers {
+		slot := m.slots[name]
+		status := w.Status()
+		infos = append(infos, WorkerInfo{
+			Name:        name,
+			Index:       slot.index,
+			Addr:        w.Addr(),
+			Port:        slot.port,
+			MetricsPort: slot.metricsPort,
+			Running:     status.State.IsRunning(),
+			State:       status.State.String(),
+			Restarts:    status.Restarts,
+			Message:     status.Message,
+			Spare:       m.spares[name],
+			Generation:  m.generations[name],
+		})
+	}
+	slices.SortFunc(infos, func(a, b WorkerInfo) int { return a.Index - b.Index })
+	return infos
+}
+
+// CrashReports returns the last crash reports of all workers, latest first.
+func (m *Manager) CrashReports() []worker.CrashReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reports := []worker.CrashReport{}
+	for _, w := range m.workers {
+		reports = append(reports, w.CrashReports()...)
+	}
+	slices.SortFunc(reports, func(a, b worker.CrashReport) int { return b.ExitedAt.Compare(a.ExitedAt) })
+	return reports
+}
+
+// ScaleUp starts one more active worker on the lowest free ports and returns the new
+// number of active workers. A worker whose process fails to spawn is removed again.
+func (m *Manager) ScaleUp() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.runCtx == nil || m.runCtx.Err() != nil {
+		return m.activeCount(), ErrNotRunning
+	}
+
+	if m.maxWorkers > 0 && m.activeCount() >= m.maxWorkers {
+		return m.activeCount(), ErrMaxWorkers
+	}
+
+	name, w, err := m.addWorker(m.freeIndex(), m.workDir)
+	if err != nil {
+		return m.activeCount(), err
+	}
+	m.runWorker(name, w, func(error) { m.removeFailed(name, w) })
+
+	log.Info("Worker added", slog.Any("worker", w), slog.Int("workers_count", m.activeCount()))
+	return m.activeCount(), nil
+}
+
+// ScaleDown drains and stops the active worker with the highest index, releasing its
+// ports for reuse, and returns the new number of active workers.
+func (m *Manager) ScaleDown(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	if m.runCtx == nil || m.runCtx.Err() != nil {
+		defer m.mu.Unlock()
+		return m.activeCount(), ErrNotRunning
+	}
+	if m.activeCount() <= m.minWorkers {
+		defer m.mu.Unlock()
+		return m.activeCount(), ErrMinWorkers
 	}
 
-	var err error
+	name := m.lastWorkerName()
+	w, handle := m.workers[name], m.handles[name]
+	// The worker leaves the membership right away so that health checks, probes and
+	// metrics stop seeing it, while its port stays reserved until it has stopped.
+	delete(m.workers, name)
+	delete(m.handles, name)
+	count := m.activeCount()
+	m.mu.Unlock()
+
+	// Stopping the worker drains it first, so the port is released once in-flight
+	// requests have finished and the process has exited.
+	log.Info("Removing worker", slog.Any("worker", w), slog.Int("workers_count", count))
+	handle.cancel()
+
 	select {
-	case err = <-errChan:
+	case <-handle.done:
+		m.releaseSlot(name)
+		log.Info("Worker removed", slog.Any("worker", w))
+		return count, nil
 	case <-ctx.Done():
+		go func() {
+			<-handle.done
+			m.releaseSlot(name)
+			log.Info("Worker removed", slog.Any("worker", w))
+		}()
+		return count, ctx.Err()
 	}
+}
 
-	cancel()
-	wg.Wait()
-	return err
+// releaseSlot frees the ports of a stopped worker and drops its metrics.
+func (m *Manager) releaseSlot(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slot := m.slots[name]
+	m.ports.release(slot.port, slot.metricsPort)
+	delete(m.slots, name)
+	delete(m.generations, name)
+	worker.DeleteMetrics(name)
 }
 
-func (m *Manager) GetWorkers() map[string]worker.Worker {
-	return m.workers
+// addWorker creates a worker of the current generation at the given index on newly
+// allocated ports, running in dir. The caller must hold m.mu unless the manager is not shared yet.
+func (m *Manager) addWorker(index int, dir string) (string, worker.Worker, error) {
+	name := workerName(index)
+
+	if m.unixSockets {
+		w := m.newWorker(workerSlot{index: index}, dir)
+		m.workers[name] = w
+		m.slots[name] = workerSlot{index: index}
+		m.generations[name] = m.generation
+		log.Info("Worker socket assigned", slog.String("worker", name), slog.String("addr", w.Addr()))
+		return name, w, nil
+	}
+
+	port, err := m.ports.allocate(m.portRange)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to allocate port for %s: %w", name, err)
+	}
+
+	metricsPort, err := m.ports.allocate(m.metricsRange)
+	if err != nil {
+		m.ports.release(port)
+		return "", nil, fmt.Errorf("failed to allocate metrics port for %s: %w", name, err)
+	}
+
+	slot := workerSlot{index: index, port: port, metricsPort: metricsPort}
+	w := m.newWorker(slot, dir)
+	m.workers[name] = w
+	m.slots[name] = slot
+	m.generations[name] = m.generation
+
+	log.Info("Worker ports allocated", slog.String("worker", name), slog.Int("port", port), slog.Int("metrics_port", metricsPort))
+	return name, w, nil
 }
 
-func (m *Manager) GetWorkerNames() []string {
-	names := make([]string, 0, len(m.workers))
-	for k := range m.workers {
-		names = append(names, k)
+// freeIndex returns the lowest index not taken by a worker. The caller must hold m.mu.
+func (m *Manager) freeIndex() int {
+	taken := make(map[int]bool, len(m.slots))
+	for _, slot := range m.slots {
+		taken[slot.index] = true
 	}
 
-	return names
+	index := 0
+	for taken[index] {
+		index++
+	}
+	return index
+}
+
+// lastWorkerName returns the name of the active worker with the highest index. The caller must hold m.mu.
+func (m *Manager) lastWorkerName() string {
+	var last string
+	for name := range m.workers {
+		if m.spares[name] {
+			continue
+		}
+		if last == "" || m.slots[name].index > m.slots[last].index {
+			last = name
+		}
+	}
+	return last
+}
+
+// activeCount returns the number of workers that are not spares. The caller must hold m.mu.
+func (m *Manager) activeCount() int {
+	return len(m.workers) - len(m.spares)
+}
+
+// handleEvent queues the active workers that leave rotation because their process
+// exited or is being stopped, so that spares replace them. It is called by the
+// worker publishing the event and must not call back into workers or the manager.
+func (m *Manager) handleEvent(e worker.Event) {
+	if e.Status.Spare || !e.From.IsRunning() {
+		return
+	}
+	if state := e.Status.State; state != worker.StateDraining && state != worker.StateExited {
+		return
+	}
+
+	m.vacatedMu.Lock()
+	m.vacated = append(m.vacated, e.Worker.String())
+	m.vacatedMu.Unlock()
+
+	select {
+	case m.vacatedChan <- struct{}{}:
+	default:
+	}
+}
+
+// promoteSpares replaces the queued active workers with ready spares.
+func (m *Manager) promoteSpares() {
+	m.vacatedMu.Lock()
+	names := m.vacated
+	m.vacated = nil
+	m.vacatedMu.Unlock()
+
+	for _, name := range names {
+		m.promoteSpare(name)
+	}
+}
+
+// promoteSpare puts the ready spare with the lowest index into rotation in place of
+// the named active worker, which becomes a spare. The replaced worker restarts its
+// process on its own and takes no requests until another worker leaves rotation.
+func (m *Manager) promoteSpare(name string) {
+	m.mu.Lock()
+	replaced, ok := m.workers[name]
+	// Workers that were removed or are stopped along with the relay are not replaced.
+	if !ok || m.spares[name] || m.runCtx == nil || m.runCtx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+
+	var spareName string
+	for candidate := range m.spares {
+		// Workers of a generation booted by a reload wait for the whole generation to be swapped in.
+		status := m.workers[candidate].Status()
+		if m.generations[candidate] != m.generation || status.State != worker.StateReady || status.CrashLooping {
+			continue
+		}
+		if spareName == "" || m.slots[candidate].index < m.slots[spareName].index {
+			spareName = candidate
+		}
+	}
+	if spareName == "" {
+		m.mu.Unlock()
+		sparePromotionsTotal.WithLabelValues(promotionUnavailable).Inc()
+		log.Warn("No ready spare to replace worker", slog.String("worker", name), slog.Int("spares_count", len(m.spares)))
+		return
+	}
+
+	spare := m.workers[spareName]
+	delete(m.spares, spareName)
+	m.spares[name] = true
+	m.mu.Unlock()
+
+	spare.SetSpare(false)
+	replaced.SetSpare(true)
+	sparePromotionsTotal.WithLabelValues(promotionPromoted).Inc()
+	log.Info("Spare worker promoted", slog.Any("worker", spare), slog.Any("replaced", replaced))
+}
+
+// beginRestart marks a rolling restart or a reload as running, identified by the error
+// that requests for another one get meanwhile. As they cannot overlap, it fails
+// with the error of the one already running.
+func (m *Manager) beginRestart(inProgress error) error {
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+
+	if m.restarting != nil {
+		return m.restarting
+	}
+	m.restarting = inProgress
+	return nil
+}
+
+func (m *Manager) endRestart() {
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+	m.restarting = nil
+}
+
+// RollingRestart restarts workers in batches, waiting for every restarted worker
+// to pass a health check before moving on to the next batch.
+func (m *Manager) RollingRestart(ctx context.Context, hc HealthChecker) error {
+	if err := m.beginRestart(ErrRollingRestartInProgress); err != nil {
+		return err
+	}
+	defer m.endRestart()
+
+	workers := m.GetWorkers()
+	names := slices.Sorted(maps.Keys(workers))
+
+	log.Info("Starting rolling restart", slog.Int("workers_count", len(names)), slog.Int("batch_size", m.rollingRestart.BatchSize))
+	for batch := range slices.Chunk(names, m.rollingRestart.BatchSize) {
+		if err := m.restartBatch(ctx, hc, workers, batch); err != nil {
+			log.Error("Rolling restart aborted", slog.Any("workers", batch), slog.Any("error", err))
+			return err
+		}
+	}
+	log.Info("Rolling restart finished")
+	return nil
+}
+
+func (m *Manager) restartBatch(ctx context.Context, hc HealthChecker, workers map[string]worker.Worker, names []string) error {
+	log.Info("Restarting workers", slog.Any("workers", names))
+
+	// Workers removed by scaling or a reload since the restart began are skipped.
+	restarted := make(map[string]<-chan struct{}, len(names))
+	for _, name := range names {
+		if !m.isMember(name, workers[name]) {
+			log.Info("Worker left before its restart, skipping", slog.String("worker", name))
+			continue
+		}
+		restarted[name] = workers[name].Recycle(worker.RestartReasonRollingRestart)
+	}
+
+	for _, name := range names {
+		done, ok := restarted[name]
+		if !ok {
+			continue
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := restarted[name]; !ok {
+			continue
+		}
+		if err := m.waitReady(ctx, hc, name, workers[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitReady checks the restarted worker every check interval until it is ready,
+// or until it leaves the membership and no longer needs to be waited for.
+func (m *Manager) waitReady(ctx context.Context, hc HealthChecker, name string, w worker.Worker) error {
+	readyCtx, cancel := context.WithTimeout(ctx, m.rollingRestart.ReadyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(m.rollingRestart.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if !m.isMember(name, w) {
+			log.Info("Worker left during its restart, skipping", slog.String("worker", name))
+			return nil
+		}
+		if state := hc.CheckWorker(readyCtx, w); state == connectivity.Ready {
+			log.Info("Worker is ready after restart", slog.Any("worker", w))
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-readyCtx.Done():
+			return fmt.Errorf("worker %s did not become ready: %w", w, readyCtx.Err())
+		}
+	}
+}
+
+// isMember tells whether the worker is still the one running under the name.
+func (m *Manager) isMember(name string, w worker.Worker) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.workers[name] == w
+}
+
+// waitHealthy checks the worker every interval until it is ready or ctx is done.
+func waitHealthy(ctx context.Context, hc HealthChecker, w worker.Worker, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if state := hc.CheckWorker(ctx, w); state == connectivity.Ready {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("worker %s did not become ready: %w", w, ctx.Err())
+		}
+	}
 }
@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: manager.go
+//
+// Generated by this command:
+//
+//	mockgen -source=manager.go -destination=manager_mock.go -package=manager
+//
+
+// Package manager is a generated GoMock package.
+package manager
+
+import (
+	context "context"
+	reflect "reflect"
+
+	worker "github.com/bibendi/gruf-relay/internal/worker"
+	gomock "go.uber.org/mock/gomock"
+	connectivity "google.golang.org/grpc/connectivity"
+)
+
+// MockHealthChecker is a mock of HealthChecker interface.
+type MockHealthChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockHealthCheckerMockRecorder
+	isgomock struct{}
+}
+
+// MockHealthCheckerMockRecorder is the mock recorder for MockHealthChecker.
+type MockHealthCheckerMockRecorder struct {
+	mock *MockHealthChecker
+}
+
+// NewMockHealthChecker creates a new mock instance.
+func NewMockHealthChecker(ctrl *gomock.Controller) *MockHealthChecker {
+	mock := &MockHealthChecker{ctrl: ctrl}
+	mock.recorder = &MockHealthCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHealthChecker) EXPECT() *MockHealthCheckerMockRecorder {
+	return m.recorder
+}
+
+// CheckWorker mocks base method.
+func (m *MockHealthChecker) CheckWorker(ctx context.Context, w worker.Worker) connectivity.State {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckWorker", ctx, w)
+	ret0, _ := ret[0].(connectivity.State)
+	return ret0
+}
+
+// CheckWorker indicates an expected call of CheckWorker.
+func (mr *MockHealthCheckerMockRecorder) CheckWorker(ctx, w any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckWorker", reflect.TypeOf((*MockHealthChecker)(nil).CheckWorker), ctx, w)
+}
+
+// MockBalancer is a mock of Balancer interface.
+type MockBalancer struct {
+	ctrl     *gomock.Controller
+	recorder *MockBalancerMockRecorder
+	isgomock struct{}
+}
+
+// MockBalancerMockRecorder is the mock recorder for MockBalancer.
+type MockBalancerMockRecorder struct {
+	mock *MockBalancer
+}
+
+// NewMockBalancer creates a new mock instance.
+func NewMockBalancer(ctrl *gomock.Controller) *MockBalancer {
+	mock := &MockBalancer{ctrl: ctrl}
+	mock.recorder = &MockBalancerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBalancer) EXPECT() *MockBalancerMockRecorder {
+	return m.recorder
+}
+
+// Swap mocks base method.
+func (m *MockBalancer) Swap(add, remove []worker.Worker) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Swap", add, remove)
+}
+
+// Swap indicates an expected call of Swap.
+func (mr *MockBalancerMockRecorder) Swap(add, remove any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Swap", reflect.TypeOf((*MockBalancer)(nil).Swap), add, remove)
+}
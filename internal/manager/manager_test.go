@@ -3,12 +3,15 @@ package manager
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/connectivity"
 
 	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/worker"
@@ -39,14 +42,34 @@ var _ = Describe("Manager", func() {
 		})
 	})
 
+	newManager := func() *Manager {
+		manager, err := NewManager(workersCfg, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return manager
+	}
+
 	Describe("NewManager", func() {
 		It("should create a new manager with the correct number of workers", func() {
-			manager := NewManager(workersCfg)
+			manager := newManager()
 			Expect(manager).NotTo(BeNil())
 			Expect(len(manager.GetWorkers())).To(Equal(2))
 		})
 	})
 
+	Describe("unix transport", func() {
+		It("gives workers sockets instead of ports", func() {
+			dir := filepath.Join(GinkgoT().TempDir(), "sockets")
+			workersCfg.Transport = config.TransportUnix
+			workersCfg.SocketDir = dir
+
+			manager := newManager()
+			Expect(dir).To(BeADirectory())
+			Expect(manager.GetWorkers()["worker-1"].Addr()).To(Equal("unix:" + filepath.Join(dir, "worker-1.sock")))
+			Expect(manager.slots["worker-1"]).To(Equal(workerSlot{index: 0}))
+			Expect(manager.ports.used).To(BeEmpty())
+		})
+	})
+
 	Describe("Run", func() {
 		It("runs all workers correctly", func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -56,7 +79,7 @@ var _ = Describe("Manager", func() {
 			worker1.EXPECT().Run(gomock.Any()).Return(nil)
 			worker2.EXPECT().Run(gomock.Any()).Return(nil)
 
-			manager := NewManager(workersCfg)
+			manager := newManager()
 			manager.workers = map[string]worker.Worker{
 				"worker-1": worker1,
 				"worker-2": worker2,
@@ -76,7 +99,7 @@ var _ = Describe("Manager", func() {
 			worker2.EXPECT().Run(gomock.Any()).Return(nil).AnyTimes()
 			worker2.EXPECT().String().Return("worker-2").AnyTimes()
 
-			manager := NewManager(workersCfg)
+			manager := newManager()
 			manager.workers = map[string]worker.Worker{
 				"worker-1": worker1,
 				"worker-2": worker2,
@@ -104,7 +127,7 @@ var _ = Describe("Manager", func() {
 			worker3.EXPECT().Run(gomock.Any()).Return(expectedError)
 			worker3.EXPECT().String().Return("worker-3").AnyTimes()
 
-			manager := NewManager(workersCfg)
+			manager := newManager()
 			manager.workers = map[string]worker.Worker{
 				"worker-1": worker1,
 				"worker-2": worker2,
@@ -115,5 +138,553 @@ var _ = Describe("Manager", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(Equal(expectedError))
 		})
+
+		It("returns an error when all workers are crash looping", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			worker1 := worker.NewMockWorker(ctrl)
+			worker2 := worker.NewMockWorker(ctrl)
+			for _, w := range []*worker.MockWorker{worker1, worker2} {
+				w.EXPECT().Run(gomock.Any()).DoAndReturn(func(ctx context.Context) error {
+					<-ctx.Done()
+					return nil
+				})
+				w.EXPECT().IsCrashLooping().Return(true).AnyTimes()
+			}
+
+			workersCfg.Restart.ExitOnCrashLoop = true
+			manager := newManager()
+			manager.workers = map[string]worker.Worker{
+				"worker-1": worker1,
+				"worker-2": worker2,
+			}
+
+			err := manager.Run(ctx)
+			Expect(err).To(MatchError(ErrAllWorkersCrashLooping))
+		})
+
+		It("keeps running while some workers are healthy", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			defer cancel()
+			worker1 := worker.NewMockWorker(ctrl)
+			worker2 := worker.NewMockWorker(ctrl)
+			for _, w := range []*worker.MockWorker{worker1, worker2} {
+				w.EXPECT().Run(gomock.Any()).DoAndReturn(func(ctx context.Context) error {
+					<-ctx.Done()
+					return nil
+				})
+			}
+			worker1.EXPECT().IsCrashLooping().Return(true).AnyTimes()
+			worker2.EXPECT().IsCrashLooping().Return(false).AnyTimes()
+
+			workersCfg.Restart.ExitOnCrashLoop = true
+			manager := newManager()
+			manager.workers = map[string]worker.Worker{
+				"worker-1": worker1,
+				"worker-2": worker2,
+			}
+
+			Expect(manager.Run(ctx)).To(Succeed())
+		})
+	})
+
+	Describe("RollingRestart", func() {
+		var (
+			hc      *MockHealthChecker
+			manager *Manager
+			worker1 *worker.MockWorker
+			worker2 *worker.MockWorker
+		)
+
+		restarted := func() <-chan struct{} {
+			done := make(chan struct{})
+			close(done)
+			return done
+		}
+
+		BeforeEach(func() {
+			hc = NewMockHealthChecker(ctrl)
+			worker1 = worker.NewMockWorker(ctrl)
+			worker2 = worker.NewMockWorker(ctrl)
+			worker1.EXPECT().String().Return("worker-1").AnyTimes()
+			worker2.EXPECT().String().Return("worker-2").AnyTimes()
+
+			workersCfg.RollingRestart = config.RollingRestart{
+				BatchSize:     1,
+				ReadyTimeout:  200 * time.Millisecond,
+				CheckInterval: 10 * time.Millisecond,
+			}
+		})
+
+		JustBeforeEach(func() {
+			manager = newManager()
+			manager.workers = map[string]worker.Worker{
+				"worker-1": worker1,
+				"worker-2": worker2,
+			}
+		})
+
+		It("restarts workers one by one waiting for each to become ready", func() {
+			gomock.InOrder(
+				worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted()),
+				hc.EXPECT().CheckWorker(gomock.Any(), worker1).Return(connectivity.Connecting),
+				hc.EXPECT().CheckWorker(gomock.Any(), worker1).Return(connectivity.Ready),
+				worker2.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted()),
+				hc.EXPECT().CheckWorker(gomock.Any(), worker2).Return(connectivity.Ready),
+			)
+
+			Expect(manager.RollingRestart(context.Background(), hc)).To(Succeed())
+		})
+
+		Context("with batch size of two", func() {
+			BeforeEach(func() {
+				workersCfg.RollingRestart.BatchSize = 2
+			})
+
+			It("restarts workers of a batch together", func() {
+				worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted())
+				worker2.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted())
+				hc.EXPECT().CheckWorker(gomock.Any(), worker1).Return(connectivity.Ready)
+				hc.EXPECT().CheckWorker(gomock.Any(), worker2).Return(connectivity.Ready)
+
+				Expect(manager.RollingRestart(context.Background(), hc)).To(Succeed())
+			})
+		})
+
+		It("skips workers that left the membership", func() {
+			gomock.InOrder(
+				worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).DoAndReturn(func(string) <-chan struct{} {
+					manager.mu.Lock()
+					delete(manager.workers, "worker-2")
+					manager.mu.Unlock()
+					return restarted()
+				}),
+				hc.EXPECT().CheckWorker(gomock.Any(), worker1).Return(connectivity.Ready),
+			)
+
+			Expect(manager.RollingRestart(context.Background(), hc)).To(Succeed())
+		})
+
+		It("stops waiting for a worker that leaves during its restart", func() {
+			worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted())
+			hc.EXPECT().CheckWorker(gomock.Any(), worker1).DoAndReturn(func(context.Context, worker.Worker) connectivity.State {
+				manager.mu.Lock()
+				delete(manager.workers, "worker-1")
+				manager.mu.Unlock()
+				return connectivity.TransientFailure
+			})
+			worker2.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted())
+			hc.EXPECT().CheckWorker(gomock.Any(), worker2).Return(connectivity.Ready)
+
+			Expect(manager.RollingRestart(context.Background(), hc)).To(Succeed())
+		})
+
+		It("aborts when a worker does not become ready in time", func() {
+			worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted())
+			hc.EXPECT().CheckWorker(gomock.Any(), worker1).Return(connectivity.TransientFailure).MinTimes(1)
+
+			err := manager.RollingRestart(context.Background(), hc)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("rejects a concurrent rolling restart", func() {
+			release := make(chan struct{})
+			worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(release)
+			worker1.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted()).AnyTimes()
+			worker2.EXPECT().Recycle(worker.RestartReasonRollingRestart).Return(restarted()).AnyTimes()
+			hc.EXPECT().CheckWorker(gomock.Any(), gomock.Any()).Return(connectivity.Ready).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- manager.RollingRestart(context.Background(), hc)
+			}()
+
+			Eventually(func() error {
+				manager.restartMu.Lock()
+				defer manager.restartMu.Unlock()
+				return manager.restarting
+			}).Should(Equal(ErrRollingRestartInProgress))
+			Expect(manager.RollingRestart(context.Background(), hc)).To(MatchError(ErrRollingRestartInProgress))
+
+			close(release)
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+	})
+
+	Describe("Scaling", func() {
+		var (
+			manager *Manager
+			cancel  context.CancelFunc
+			runErr  chan error
+			created []int
+		)
+
+		newWorker := func(slot workerSlot, _ string) worker.Worker {
+			index := slot.index
+			w := worker.NewMockWorker(ctrl)
+			w.EXPECT().String().Return(workerName(index)).AnyTimes()
+			w.EXPECT().Run(gomock.Any()).DoAndReturn(func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			})
+			created = append(created, slot.port)
+			return w
+		}
+
+		BeforeEach(func() {
+			created = nil
+			manager = newManager()
+			manager.newWorker = newWorker
+			manager.workers = map[string]worker.Worker{
+				"worker-1": newWorker(manager.slots["worker-1"], ""),
+				"worker-2": newWorker(manager.slots["worker-2"], ""),
+			}
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			runErr = make(chan error, 1)
+			go func() {
+				runErr <- manager.Run(ctx)
+			}()
+			Eventually(func() bool {
+				manager.mu.RLock()
+				defer manager.mu.RUnlock()
+				return manager.runCtx != nil
+			}).Should(BeTrue())
+
+			DeferCleanup(func() {
+				cancel()
+				Eventually(runErr).Should(Receive(BeNil()))
+			})
+		})
+
+		It("refuses to scale before the manager runs", func() {
+			_, err := newManager().ScaleUp()
+			Expect(err).To(MatchError(ErrNotRunning))
+		})
+
+		It("adds a worker on the next free port", func() {
+			count, err := manager.ScaleUp()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(3))
+			Expect(manager.GetWorkerNames()).To(ConsistOf("worker-1", "worker-2", "worker-3"))
+			Expect(created).To(Equal([]int{9000, 9001, 9002}))
+		})
+
+		It("removes an added worker that fails to start without stopping the relay", func() {
+			manager.newWorker = func(slot workerSlot, _ string) worker.Worker {
+				w := worker.NewMockWorker(ctrl)
+				w.EXPECT().String().Return(workerName(slot.index)).AnyTimes()
+				w.EXPECT().Run(gomock.Any()).Return(errors.New("exec: bin/gruf: no such file"))
+				return w
+			}
+
+			count, err := manager.ScaleUp()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(3))
+
+			Eventually(manager.GetWorkerNames).Should(ConsistOf("worker-1", "worker-2"))
+			Eventually(func() map[int]bool {
+				manager.mu.RLock()
+				defer manager.mu.RUnlock()
+				return manager.ports.used
+			}).Should(HaveLen(4))
+			Consistently(runErr, 50*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("stops the removed worker and reuses its port", func() {
+			count, err := manager.ScaleDown(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(1))
+			Expect(manager.GetWorkerNames()).To(ConsistOf("worker-1"))
+
+			count, err = manager.ScaleUp()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(2))
+			Expect(created).To(Equal([]int{9000, 9001, 9001}))
+		})
+
+		It("keeps the last worker", func() {
+			_, err := manager.ScaleDown(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			count, err := manager.ScaleDown(context.Background())
+			Expect(err).To(MatchError(ErrMinWorkers))
+			Expect(count).To(Equal(1))
+		})
+
+		It("keeps at most the maximum number of workers", func() {
+			manager.maxWorkers = 2
+
+			count, err := manager.ScaleUp()
+			Expect(err).To(MatchError(ErrMaxWorkers))
+			Expect(count).To(Equal(2))
+			Expect(created).To(Equal([]int{9000, 9001}))
+		})
+
+		It("lists the workers with their ports", func() {
+			for name, w := range manager.workers {
+				w.(*worker.MockWorker).EXPECT().Status().Return(worker.Status{State: worker.StateReady, Restarts: 1})
+				w.(*worker.MockWorker).EXPECT().Addr().Return(name + "-addr")
+			}
+
+			Expect(manager.ListWorkers()).To(Equal([]WorkerInfo{
+				{Name: "worker-1", Index: 0, Addr: "worker-1-addr", Port: 9000, MetricsPort: 9100, Running: true, State: "ready", Restarts: 1},
+				{Name: "worker-2", Index: 1, Addr: "worker-2-addr", Port: 9001, MetricsPort: 9101, Running: true, State: "ready", Restarts: 1},
+			}))
+		})
+	})
+
+	Describe("Reload", func() {
+		var (
+			manager *Manager
+			hc      *MockHealthChecker
+			lb      *MockBalancer
+			cancel  context.CancelFunc
+			runErr  chan error
+			dirs    map[string]string
+			release string
+		)
+
+		newWorker := func(slot workerSlot, dir string) worker.Worker {
+			name := workerName(slot.index)
+			w := worker.NewMockWorker(ctrl)
+			w.EXPECT().String().Return(name).AnyTimes()
+			w.EXPECT().SetSpare(gomock.Any()).AnyTimes()
+			w.EXPECT().Run(gomock.Any()).DoAndReturn(func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			})
+			dirs[name] = dir
+			return w
+		}
+
+		BeforeEach(func() {
+			root := GinkgoT().TempDir()
+			release = filepath.Join(root, "releases", "2")
+			Expect(os.MkdirAll(filepath.Join(root, "releases", "1"), 0o755)).To(Succeed())
+			Expect(os.MkdirAll(release, 0o755)).To(Succeed())
+			Expect(os.Symlink(filepath.Join(root, "releases", "1"), filepath.Join(root, "current"))).To(Succeed())
+
+			workersCfg.Dir = filepath.Join(root, "current")
+			workersCfg.Reload = config.Reload{ReadyTimeout: 200 * time.Millisecond, CheckInterval: 10 * time.Millisecond}
+			hc = NewMockHealthChecker(ctrl)
+			lb = NewMockBalancer(ctrl)
+			dirs = map[string]string{}
+
+			manager = newManager()
+			Expect(manager.workDir).To(Equal(filepath.Join(root, "releases", "1")))
+			manager.newWorker = newWorker
+			manager.workers = map[string]worker.Worker{
+				"worker-1": newWorker(manager.slots["worker-1"], manager.workDir),
+				"worker-2": newWorker(manager.slots["worker-2"], manager.workDir),
+			}
+
+			// The current symlink is switched to the new release by the deploy.
+			Expect(os.Remove(workersCfg.Dir)).To(Succeed())
+			Expect(os.Symlink(release, workersCfg.Dir)).To(Succeed())
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			runErr = make(chan error, 1)
+			go func() {
+				runErr <- manager.Run(ctx)
+			}()
+			Eventually(func() bool {
+				manager.mu.RLock()
+				defer manager.mu.RUnlock()
+				return manager.runCtx != nil
+			}).Should(BeTrue())
+
+			DeferCleanup(func() {
+				cancel()
+				Eventually(runErr).Should(Receive(BeNil()))
+			})
+		})
+
+		It("swaps in a new generation from the resolved release once it is ready", func() {
+			hc.EXPECT().CheckWorker(gomock.Any(), gomock.Any()).Return(connectivity.Ready).Times(2)
+			lb.EXPECT().Swap(gomock.Any(), gomock.Any()).Do(func(add, remove []worker.Worker) {
+				Expect(names(add)).To(ConsistOf("worker-3", "worker-4"))
+				Expect(names(remove)).To(ConsistOf("worker-1", "worker-2"))
+			})
+
+			Expect(manager.Reload(context.Background(), hc, lb)).To(Succeed())
+			Expect(manager.GetWorkerNames()).To(ConsistOf("worker-3", "worker-4"))
+			Expect(dirs).To(HaveKeyWithValue("worker-3", release))
+			Expect(dirs).To(HaveKeyWithValue("worker-4", release))
+			Expect(manager.workDir).To(Equal(release))
+			Expect(manager.spares).To(BeEmpty())
+			Expect(manager.generations).To(Equal(map[string]int{"worker-3": 1, "worker-4": 1}))
+			Expect(manager.slots).To(HaveLen(2))
+		})
+
+		It("keeps the old generation when the new one does not become ready in time", func() {
+			hc.EXPECT().CheckWorker(gomock.Any(), gomock.Any()).Return(connectivity.Connecting).AnyTimes()
+
+			Expect(manager.Reload(context.Background(), hc, lb)).To(MatchError(context.DeadlineExceeded))
+			Expect(manager.GetWorkerNames()).To(ConsistOf("worker-1", "worker-2"))
+			Expect(manager.workDir).NotTo(Equal(release))
+			Expect(manager.spares).To(BeEmpty())
+			Expect(manager.slots).To(HaveLen(2))
+			Expect(manager.ports.used).To(HaveLen(4))
+		})
+
+		It("keeps the old generation when a new worker fails to start", func() {
+			manager.newWorker = func(slot workerSlot, _ string) worker.Worker {
+				w := worker.NewMockWorker(ctrl)
+				w.EXPECT().String().Return(workerName(slot.index)).AnyTimes()
+				w.EXPECT().SetSpare(gomock.Any()).AnyTimes()
+				w.EXPECT().Run(gomock.Any()).Return(errors.New("exec: bin/gruf: no such file"))
+				return w
+			}
+			hc.EXPECT().CheckWorker(gomock.Any(), gomock.Any()).Return(connectivity.Connecting).AnyTimes()
+
+			Expect(manager.Reload(context.Background(), hc, lb)).To(MatchError("exec: bin/gruf: no such file"))
+			Expect(manager.GetWorkerNames()).To(ConsistOf("worker-1", "worker-2"))
+			Expect(manager.workDir).NotTo(Equal(release))
+			Expect(manager.spares).To(BeEmpty())
+			Expect(manager.slots).To(HaveLen(2))
+			Expect(manager.ports.used).To(HaveLen(4))
+			Consistently(runErr, 50*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("rejects a reload during a rolling restart", func() {
+			Expect(manager.beginRestart(ErrRollingRestartInProgress)).To(Succeed())
+			Expect(manager.Reload(context.Background(), hc, lb)).To(MatchError(ErrRollingRestartInProgress))
+		})
+
+		It("rejects a rolling restart during a reload", func() {
+			Expect(manager.beginRestart(ErrReloadInProgress)).To(Succeed())
+			Expect(manager.RollingRestart(context.Background(), hc)).To(MatchError(ErrReloadInProgress))
+		})
+	})
+
+	Describe("Spares", func() {
+		var (
+			manager *Manager
+			active  *worker.MockWorker
+			spare   *worker.MockWorker
+		)
+
+		BeforeEach(func() {
+			workersCfg.Spares = 1
+			manager = newManager()
+			manager.runCtx = context.Background()
+
+			active = worker.NewMockWorker(ctrl)
+			active.EXPECT().String().Return("worker-1").AnyTimes()
+			spare = worker.NewMockWorker(ctrl)
+			spare.EXPECT().String().Return("worker-3").AnyTimes()
+			manager.workers["worker-1"] = active
+			manager.workers["worker-3"] = spare
+		})
+
+		leave := func(w worker.Worker, status worker.Status) {
+			manager.handleEvent(worker.Event{Worker: w, From: worker.StateReady, Status: status})
+			manager.promoteSpares()
+		}
+
+		It("starts the spares after the active workers", func() {
+			manager := newManager()
+			Expect(manager.GetWorkers()).To(HaveLen(3))
+			Expect(manager.spares).To(Equal(map[string]bool{"worker-3": true}))
+			Expect(manager.GetWorkers()["worker-3"].Status().Spare).To(BeTrue())
+		})
+
+		It("promotes a ready spare when an active worker exits", func() {
+			spare.EXPECT().Status().Return(worker.Status{State: worker.StateReady, Spare: true})
+			gomock.InOrder(
+				spare.EXPECT().SetSpare(false),
+				active.EXPECT().SetSpare(true),
+			)
+
+			leave(active, worker.Status{State: worker.StateExited})
+			Expect(manager.spares).To(Equal(map[string]bool{"worker-1": true}))
+		})
+
+		It("promotes a ready spare when an active worker is recycled", func() {
+			spare.EXPECT().Status().Return(worker.Status{State: worker.StateReady, Spare: true})
+			spare.EXPECT().SetSpare(false)
+			active.EXPECT().SetSpare(true)
+
+			leave(active, worker.Status{State: worker.StateDraining})
+			Expect(manager.spares).To(Equal(map[string]bool{"worker-1": true}))
+		})
+
+		It("keeps the active worker when no spare is ready", func() {
+			spare.EXPECT().Status().Return(worker.Status{State: worker.StateBooting, Spare: true})
+
+			leave(active, worker.Status{State: worker.StateExited})
+			Expect(manager.spares).To(Equal(map[string]bool{"worker-3": true}))
+		})
+
+		It("does not replace spares and workers that stay in rotation", func() {
+			leave(spare, worker.Status{State: worker.StateExited, Spare: true})
+			leave(active, worker.Status{State: worker.StateUnhealthy})
+			Expect(manager.spares).To(Equal(map[string]bool{"worker-3": true}))
+		})
+
+		It("does not replace workers stopped along with the relay", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			manager.runCtx = ctx
+
+			leave(active, worker.Status{State: worker.StateDraining})
+			Expect(manager.spares).To(Equal(map[string]bool{"worker-3": true}))
+		})
+
+		It("lists the spares", func() {
+			for name, w := range manager.workers {
+				if mw, ok := w.(*worker.MockWorker); ok {
+					mw.EXPECT().Status().Return(worker.Status{State: worker.StateReady})
+					mw.EXPECT().Addr().Return(name + "-addr")
+				}
+			}
+
+			infos := manager.ListWorkers()
+			Expect(infos).To(HaveLen(3))
+			Expect(infos[2].Name).To(Equal("worker-3"))
+			Expect(infos[2].Spare).To(BeTrue())
+			Expect(infos[0].Spare).To(BeFalse())
+		})
+	})
+
+	Describe("portAllocator", func() {
+		var (
+			allocator *portAllocator
+			busy      map[int]bool
+		)
+
+		BeforeEach(func() {
+			busy = map[int]bool{}
+			allocator = newPortAllocator(map[string]int{"server": 9001})
+			allocator.isFree = func(port int) bool { return !busy[port] }
+		})
+
+		It("skips ports used by workers, the relay and other processes", func() {
+			busy[9002] = true
+			r := config.PortRange{9000, 9010}
+
+			Expect(allocator.allocate(r)).To(Equal(9000))
+			Expect(allocator.allocate(r)).To(Equal(9003))
+		})
+
+		It("reuses released ports", func() {
+			r := config.PortRange{9000, 9010}
+			port, err := allocator.allocate(r)
+			Expect(err).NotTo(HaveOccurred())
+
+			allocator.release(port)
+			Expect(allocator.allocate(r)).To(Equal(port))
+		})
+
+		It("fails when the range is exhausted", func() {
+			r := config.PortRange{9000, 9001}
+			Expect(allocator.allocate(r)).To(Equal(9000))
+
+			_, err := allocator.allocate(r)
+			Expect(err).To(MatchError(ErrNoFreePorts))
+		})
 	})
 })
@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	promotionPromoted    = "promoted"
+	promotionUnavailable = "unavailable"
+
+	reloadSwapped = "swapped"
+	reloadAborted = "aborted"
+)
+
+var (
+	sparePromotionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_spare_promotions_total",
+		Help: "Total number of active workers that left rotation by whether a spare replaced them.",
+	}, []string{"result"})
+
+	reloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_reloads_total",
+		Help: "Total number of worker generation reloads by result.",
+	}, []string{"result"})
+)
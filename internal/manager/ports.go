@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/log"
+)
+
+// portAllocator hands out worker ports that are not used by other workers,
+// not reserved for the relay itself and not bound by another process on the host.
+// The caller must hold m.mu.
+type portAllocator struct {
+	reserved map[int]string
+	used     map[int]bool
+	isFree   func(port int) bool
+}
+
+func newPortAllocator(reserved map[string]int) *portAllocator {
+	a := &portAllocator{
+		reserved: make(map[int]string, len(reserved)),
+		used:     make(map[int]bool),
+		isFree:   isPortFree,
+	}
+	for name, port := range reserved {
+		a.reserved[port] = name
+	}
+	return a
+}
+
+// allocate takes the lowest free port of the range.
+func (a *portAllocator) allocate(r config.PortRange) (int, error) {
+	for port := r.First(); port <= r.Last(); port++ {
+		if a.used[port] {
+			continue
+		}
+
+		if name, ok := a.reserved[port]; ok {
+			log.Debug("Skipping port reserved by the relay", slog.Int("port", port), slog.String("reserved_by", name))
+			continue
+		}
+
+		if !a.isFree(port) {
+			log.Warn("Skipping port in use by another process", slog.Int("port", port))
+			continue
+		}
+
+		a.used[port] = true
+		return port, nil
+	}
+	return 0, fmt.Errorf("%w in range %s", ErrNoFreePorts, r)
+}
+
+func (a *portAllocator) release(ports ...int) {
+	for _, port := range ports {
+		delete(a.used, port)
+	}
+}
+
+func isPortFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+
+	"github.com/bibendi/gruf-relay/internal/log"
+	"github.com/bibendi/gruf-relay/internal/worker"
+)
+
+// Reload boots a new generation of workers, as many as there are active workers and
+// spares, from the freshly resolved workers directory. Once every new worker is ready,
+// the balancer is switched over to the new generation at once and the old one is
+// drained and stopped. When a new worker fails to start or the new generation does
+// not become ready within the ready timeout, it is stopped and the old one keeps serving.
+func (m *Manager) Reload(ctx context.Context, hc HealthChecker, lb Balancer) error {
+	if err := m.beginRestart(ErrReloadInProgress); err != nil {
+		return err
+	}
+	defer m.endRestart()
+
+	dir, err := m.resolveDir()
+	if err != nil {
+		reloadsTotal.WithLabelValues(reloadAborted).Inc()
+		return err
+	}
+
+	log.Info("Starting reload", slog.String("dir", dir))
+	next, failed, err := m.bootGeneration(dir)
+	if err == nil {
+		err = m.waitGeneration(ctx, hc, next, failed)
+	}
+	if err != nil {
+		log.Error("Reload aborted, stopping the new generation", slog.Any("workers", names(next)), slog.Any("error", err))
+		m.removeWorkers(next)
+		reloadsTotal.WithLabelValues(reloadAborted).Inc()
+		return err
+	}
+
+	old := m.swapGeneration(lb, next, dir)
+	log.Info("New generation swapped in, stopping the old one", slog.Any("workers", names(next)), slog.Any("old_workers", names(old)))
+	m.removeWorkers(old)
+
+	reloadsTotal.WithLabelValues(reloadSwapped).Inc()
+	log.Info("Reload finished", slog.String("dir", dir))
+	return nil
+}
+
+// resolveDir returns the absolute workers directory with symlinks resolved, so that
+// a generation keeps running from the release the current symlink pointed to when it
+// was booted.
+func (m *Manager) resolveDir() (string, error) {
+	if m.dir == "" {
+		return "", nil
+	}
+
+	dir, err := filepath.EvalSymlinks(m.dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve workers dir: %w", err)
+	}
+	return filepath.Abs(dir)
+}
+
+// bootGeneration starts a spare for every current worker in dir. The new workers
+// are returned in index order, also when only some of them could be started, along
+// with the channel that receives the errors of those that fail.
+func (m *Manager) bootGeneration(dir string) ([]worker.Worker, <-chan error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.runCtx == nil || m.runCtx.Err() != nil {
+		return nil, nil, ErrNotRunning
+	}
+
+	size := len(m.workers)
+	generation := m.generation + 1
+	next := make([]worker.Worker, 0, size)
+	failed := make(chan error, size)
+	for range size {
+		index := m.freeIndex()
+		name, w, err := m.addWorker(index, dir)
+		if err != nil {
+			return next, failed, err
+		}
+		m.generations[name] = generation
+		m.spares[name] = true
+		w.SetSpare(true)
+		m.runWorker(name, w, func(err error) { failed <- err })
+		next = append(next, w)
+	}
+	return next, failed, nil
+}
+
+// waitGeneration waits until every worker of the generation is ready, failing as
+// soon as one of them fails to start.
+func (m *Manager) waitGeneration(ctx context.Context, hc HealthChecker, next []worker.Worker, failed <-chan error) error {
+	readyCtx, cancel := context.WithTimeout(ctx, m.reload.ReadyTimeout)
+	defer cancel()
+	failCtx, fail := context.WithCancelCause(readyCtx)
+	defer fail(nil)
+
+	go func() {
+		select {
+		case err := <-failed:
+			fail(err)
+		case <-failCtx.Done():
+		}
+	}()
+
+	for _, w := range next {
+		if err := waitHealthy(failCtx, hc, w, m.reload.CheckInterval); err != nil {
+			if cause := context.Cause(failCtx); cause != failCtx.Err() {
+				return cause
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// swapGeneration makes the new generation current: its first workers take over the
+// active ones and the others stay spares. The previous workers leave the membership
+// and are returned for stopping.
+func (m *Manager) swapGeneration(lb Balancer, next []worker.Worker, dir string) []worker.Worker {
+	m.mu.Lock()
+	active := m.activeCount()
+	var add, old []worker.Worker
+	for i, w := range next {
+		if i < active {
+			delete(m.spares, w.String())
+			add = append(add, w)
+		}
+	}
+	for name, w := range m.workers {
+		if !slices.Contains(next, w) {
+			old = append(old, w)
+			delete(m.workers, name)
+			delete(m.spares, name)
+		}
+	}
+	m.generation++
+	m.workDir = dir
+	m.mu.Unlock()
+
+	lb.Swap(add, old)
+	// The workers follow the balancer, so that later state transitions keep them where they are.
+	for _, w := range old {
+		w.SetSpare(true)
+	}
+	for _, w := range add {
+		w.SetSpare(false)
+	}
+	return old
+}
+
+// removeWorkers takes the workers out of the membership, stops them and releases
+// their ports once they have stopped.
+func (m *Manager) removeWorkers(workers []worker.Worker) {
+	m.mu.Lock()
+	handles := make(map[string]*workerHandle, len(workers))
+	for _, w := range workers {
+		name := w.String()
+		if handle, ok := m.handles[name]; ok {
+			handles[name] = handle
+		}
+		delete(m.workers, name)
+		delete(m.handles, name)
+		delete(m.spares, name)
+	}
+	m.mu.Unlock()
+
+	for _, handle := range handles {
+		handle.cancel()
+	}
+	for name, handle := range handles {
+		<-handle.done
+		m.releaseSlot(name)
+	}
+}
+
+func names(workers []worker.Worker) []string {
+	names := make([]string, 0, len(workers))
+	for _, w := range workers {
+		names = append(names, w.String())
+	}
+	return names
+}
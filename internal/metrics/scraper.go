@@ -128,7 +128,7 @@ func (s *Scraper) scrapeAndAggregate() {
 		go func(w worker.Worker) {
 			defer wg.Done()
 
-			mfList, err := s.scrapeMetrics("http://" + w.MetricsAddr())
+			mfList, err := s.scrapeMetrics(s.clientFor(w), "http://"+w.MetricsAddr())
 			if err != nil {
 				log.Error("Error scraping metrics", slog.String("worker", name), slog.Any("error", err))
 				return
@@ -151,8 +151,27 @@ func (s *Scraper) scrapeAndAggregate() {
 	log.Info("Metrics scraped and aggregated")
 }
 
-func (s *Scraper) scrapeMetrics(url string) ([]*dto.MetricFamily, error) {
-	resp, err := s.client.Get(url)
+// clientFor returns the HTTP client that reaches the metrics endpoint of the worker.
+func (s *Scraper) clientFor(w worker.Worker) *http.Client {
+	socket := w.MetricsSocket()
+	if socket == "" {
+		return s.client
+	}
+
+	return &http.Client{
+		Timeout: s.client.Timeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+func (s *Scraper) scrapeMetrics(client *http.Client, url string) ([]*dto.MetricFamily, error) {
+	resp, err := client.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch metrics from %s: %w", url, err)
 	}
@@ -2,8 +2,10 @@ package metrics
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"time"
 
 	"github.com/bibendi/gruf-relay/internal/config"
@@ -114,6 +116,8 @@ test_metric{label="value"} 10
 			worker2.EXPECT().IsRunning().Return(true).AnyTimes()
 			worker1.EXPECT().MetricsAddr().Return(ts.URL[7:]).AnyTimes()
 			worker2.EXPECT().MetricsAddr().Return(ts.URL[7:]).AnyTimes()
+			worker1.EXPECT().MetricsSocket().Return("").AnyTimes()
+			worker2.EXPECT().MetricsSocket().Return("").AnyTimes()
 		})
 
 		AfterEach(func() {
@@ -130,7 +134,7 @@ test_metric{label="value"} 10
 	Describe("scrapeMetrics", func() {
 		It("Should return err when request failed", func() {
 			scraper = NewScraper(cfg, m)
-			_, err := scraper.scrapeMetrics("http://invalid-url")
+			_, err := scraper.scrapeMetrics(scraper.client, "http://invalid-url")
 			Expect(err).To(HaveOccurred())
 		})
 
@@ -140,10 +144,31 @@ test_metric{label="value"} 10
 				w.WriteHeader(http.StatusInternalServerError)
 			}))
 			defer ts.Close()
-			_, err := scraper.scrapeMetrics(ts.URL)
+			_, err := scraper.scrapeMetrics(scraper.client, ts.URL)
 			Expect(err).To(HaveOccurred())
 		})
 
+		It("Should return metrics over a unix socket", func() {
+			scraper = NewScraper(cfg, m)
+			socket := filepath.Join(GinkgoT().TempDir(), "worker-1-metrics.sock")
+			l, err := net.Listen("unix", socket)
+			Expect(err).ToNot(HaveOccurred())
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/metrics"))
+				_, _ = w.Write([]byte("test_metric 10\n"))
+			}))
+			ts.Listener = l
+			ts.Start()
+			defer ts.Close()
+
+			w := worker.NewMockWorker(ctrl)
+			w.EXPECT().MetricsSocket().Return(socket)
+
+			metrics, err := scraper.scrapeMetrics(scraper.clientFor(w), "http://localhost/metrics")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(metrics)).To(Equal(1))
+		})
+
 		It("Should return metrics", func() {
 			scraper = NewScraper(cfg, m)
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -155,7 +180,7 @@ test_metric{label="value"} 10
 			}))
 			defer ts.Close()
 
-			metrics, err := scraper.scrapeMetrics(ts.URL)
+			metrics, err := scraper.scrapeMetrics(scraper.client, ts.URL)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(len(metrics)).To(Equal(1))
 			Expect(*metrics[0].Name).To(Equal("test_metric"))
@@ -7,39 +7,59 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
 
 	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/log"
-	"google.golang.org/grpc/connectivity"
+	"github.com/bibendi/gruf-relay/internal/worker"
 )
 
-type HealthChecker interface {
-	GetServerState(name string) connectivity.State
-}
+// readySparesHeader reports the number of ready spare workers in readiness responses.
+const readySparesHeader = "X-Ready-Spares"
 
 type Manager interface {
 	GetWorkerNames() []string
 }
 
 type Probes struct {
-	port         int
-	appIsStarted *atomic.Value
-	m            Manager
-	hc           HealthChecker
+	port          int
+	minReady      int
+	appIsStarted  *atomic.Value
+	appIsStopping *atomic.Value
+	m             Manager
+	statuses      map[string]worker.Status
+	mu            sync.RWMutex
 }
 
-func NewProbes(cfg config.Probes, isStarted *atomic.Value, m Manager, hc HealthChecker) *Probes {
+func NewProbes(cfg config.Probes, isStarted, isStopping *atomic.Value, m Manager) *Probes {
 	probes := &Probes{
-		port:         cfg.Port,
-		m:            m,
-		hc:           hc,
-		appIsStarted: isStarted,
+		port:          cfg.Port,
+		minReady:      cfg.MinReadyWorkers,
+		m:             m,
+		appIsStarted:  isStarted,
+		appIsStopping: isStopping,
+		statuses:      make(map[string]worker.Status),
 	}
 
 	return probes
 }
 
+// HandleEvent tracks the state of workers for the readiness and liveness probes.
+func (p *Probes) HandleEvent(e worker.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.statuses[e.Worker.String()] = e.Status
+}
+
+func (p *Probes) workerStatus(name string) (worker.Status, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	status, ok := p.statuses[name]
+	return status, ok
+}
+
 func (p *Probes) Serve(ctx context.Context) error {
 	log.Info("Starting probes server", slog.Int("port", p.port))
 
@@ -54,8 +74,8 @@ func (p *Probes) Serve(ctx context.Context) error {
 	}
 
 	mux.HandleFunc("/startup", p.handleStartupProbe(p.appIsStarted))
-	mux.HandleFunc("/readiness", p.handleReadinessProbe(p.m, p.hc))
-	mux.HandleFunc("/liveness", p.handleLivenessrobe(p.m, p.hc))
+	mux.HandleFunc("/readiness", p.handleReadinessProbe(p.appIsStopping, p.m))
+	mux.HandleFunc("/liveness", p.handleLivenessrobe(p.m))
 
 	errChan := make(chan error, 1)
 	defer close(errChan)
@@ -94,30 +114,58 @@ func (p *Probes) handleStartupProbe(isStarted *atomic.Value) http.HandlerFunc {
 	}
 }
 
-func (p *Probes) handleReadinessProbe(m Manager, hc HealthChecker) http.HandlerFunc {
+func (p *Probes) handleReadinessProbe(isStopping *atomic.Value, m Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Info("Received readiness request")
+		if isStopping.Load() == true {
+			log.Error("Relay is shutting down, returning 503")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		active, ready, spares := 0, 0, 0
 		for _, name := range m.GetWorkerNames() {
-			if state := hc.GetServerState(name); state == connectivity.TransientFailure || state == connectivity.Shutdown {
-				log.Error("Readiness probe failed", slog.Any("worker", name), slog.String("state", state.String()))
-				w.WriteHeader(http.StatusServiceUnavailable)
-				return
+			status, _ := p.workerStatus(name)
+			// Spares do not serve requests, they only replace active workers that leave rotation.
+			if status.Spare {
+				if status.State == worker.StateReady {
+					spares++
+				}
+				continue
 			}
+			active++
+			// Crash looping workers stay out of rotation even when they pass health checks.
+			if status.State == worker.StateReady && !status.CrashLooping {
+				ready++
+			}
+		}
+		// The pod keeps serving with the ready workers while the others restart.
+		if ready < min(p.minReady, active) {
+			log.Error("Readiness probe failed", slog.Int("ready", ready), slog.Int("active", active), slog.Int("min_ready", p.minReady))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
 		}
+		w.Header().Set(readySparesHeader, strconv.Itoa(spares))
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func (p *Probes) handleLivenessrobe(m Manager, hc HealthChecker) http.HandlerFunc {
+func (p *Probes) handleLivenessrobe(m Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Info("Received liveness request")
-		for _, name := range m.GetWorkerNames() {
-			if state := hc.GetServerState(name); state == connectivity.Shutdown {
-				log.Error("Liveness probe failed", slog.Any("worker", name), slog.String("state", state.String()))
-				w.WriteHeader(http.StatusServiceUnavailable)
+		// A restart of the pod only helps when no worker can serve, so a single crash
+		// looping worker does not fail the probe.
+		names := m.GetWorkerNames()
+		for _, name := range names {
+			if status, _ := p.workerStatus(name); !status.CrashLooping {
+				w.WriteHeader(http.StatusOK)
 				return
 			}
 		}
-		w.WriteHeader(http.StatusOK)
+		if len(names) == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		log.Error("Liveness probe failed, all workers are crash looping", slog.Int("workers", len(names)))
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 }
@@ -13,47 +13,8 @@ import (
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
-	connectivity "google.golang.org/grpc/connectivity"
 )
 
-// MockHealthChecker is a mock of HealthChecker interface.
-type MockHealthChecker struct {
-	ctrl     *gomock.Controller
-	recorder *MockHealthCheckerMockRecorder
-	isgomock struct{}
-}
-
-// MockHealthCheckerMockRecorder is the mock recorder for MockHealthChecker.
-type MockHealthCheckerMockRecorder struct {
-	mock *MockHealthChecker
-}
-
-// NewMockHealthChecker creates a new mock instance.
-func NewMockHealthChecker(ctrl *gomock.Controller) *MockHealthChecker {
-	mock := &MockHealthChecker{ctrl: ctrl}
-	mock.recorder = &MockHealthCheckerMockRecorder{mock}
-	return mock
-}
-
-// EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockHealthChecker) EXPECT() *MockHealthCheckerMockRecorder {
-	return m.recorder
-}
-
-// GetServerState mocks base method.
-func (m *MockHealthChecker) GetServerState(name string) connectivity.State {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetServerState", name)
-	ret0, _ := ret[0].(connectivity.State)
-	return ret0
-}
-
-// GetServerState indicates an expected call of GetServerState.
-func (mr *MockHealthCheckerMockRecorder) GetServerState(name any) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerState", reflect.TypeOf((*MockHealthChecker)(nil).GetServerState), name)
-}
-
 // MockManager is a mock of Manager interface.
 type MockManager struct {
 	ctrl     *gomock.Controller
@@ -9,10 +9,10 @@ import (
 	"time"
 
 	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/worker"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
-	"google.golang.org/grpc/connectivity"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -30,18 +30,22 @@ var _ = Describe("Probes", func() {
 		cancel    context.CancelFunc
 		cfg       config.Probes
 		isStarted *atomic.Value
+		stopping  *atomic.Value
 		m         *MockManager
-		hc        *MockHealthChecker
+		workerA   *worker.MockWorker
 	)
 
 	BeforeEach(func() {
 		ctrl = gomock.NewController(GinkgoT())
 		isStarted = &atomic.Value{}
 		isStarted.Store(true)
-		cfg = config.Probes{Port: port}
+		stopping = &atomic.Value{}
+		stopping.Store(false)
+		cfg = config.Probes{Port: port, MinReadyWorkers: 1}
 		m = NewMockManager(ctrl)
 		m.EXPECT().GetWorkerNames().Return([]string{"worker-a"}).AnyTimes()
-		hc = NewMockHealthChecker(ctrl)
+		workerA = worker.NewMockWorker(ctrl)
+		workerA.EXPECT().String().Return("worker-a").AnyTimes()
 
 		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 
@@ -52,7 +56,7 @@ var _ = Describe("Probes", func() {
 	})
 
 	JustBeforeEach(func() {
-		pb = NewProbes(cfg, isStarted, m, hc)
+		pb = NewProbes(cfg, isStarted, stopping, m)
 	})
 
 	Describe("NewProbes", func() {
@@ -100,40 +104,121 @@ var _ = Describe("Probes", func() {
 			readinessURL := fmt.Sprintf("http://%s:%d/readiness", host, port)
 			go pb.Serve(ctx)
 
-			hc.EXPECT().GetServerState("worker-a").Return(connectivity.Ready)
+			setState(pb, workerA, worker.Status{State: worker.StateReady})
 			err := waitForProbe(readinessURL, 3*time.Second)
 			Expect(err).NotTo(HaveOccurred())
 
-			downStates := []connectivity.State{
-				connectivity.TransientFailure,
-				connectivity.Shutdown,
+			downStates := []worker.State{
+				worker.StateBooting,
+				worker.StateUnhealthy,
+				worker.StateDraining,
+				worker.StateBackoff,
 			}
 			for _, state := range downStates {
-				hc.EXPECT().GetServerState("worker-a").Return(state)
+				setState(pb, workerA, worker.Status{State: state})
 				err = waitForProbe(readinessURL, 100*time.Millisecond)
 				Expect(err).To(HaveOccurred())
 			}
+
+			// Test failure case when relay is shutting down
+			setState(pb, workerA, worker.Status{State: worker.StateReady})
+			stopping.Store(true)
+			err = waitForProbe(readinessURL, 100*time.Millisecond)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("stays ready on /readiness request while enough workers are ready", func() {
+			readinessURL := fmt.Sprintf("http://%s:%d/readiness", host, port)
+			workerB := worker.NewMockWorker(ctrl)
+			workerB.EXPECT().String().Return("worker-b").AnyTimes()
+			workerC := worker.NewMockWorker(ctrl)
+			workerC.EXPECT().String().Return("worker-c").AnyTimes()
+			m = NewMockManager(ctrl)
+			m.EXPECT().GetWorkerNames().Return([]string{"worker-a", "worker-b", "worker-c"}).AnyTimes()
+			cfg.MinReadyWorkers = 2
+			pb = NewProbes(cfg, isStarted, stopping, m)
+			go pb.Serve(ctx)
+
+			setState(pb, workerA, worker.Status{State: worker.StateReady})
+			setState(pb, workerB, worker.Status{State: worker.StateReady})
+			setState(pb, workerC, worker.Status{State: worker.StateBackoff})
+			Expect(waitForProbe(readinessURL, 3*time.Second)).To(Succeed())
+
+			setState(pb, workerB, worker.Status{State: worker.StateUnhealthy})
+			Expect(waitForProbe(readinessURL, 100*time.Millisecond)).NotTo(Succeed())
+		})
+
+		It("ignores spares on /readiness request", func() {
+			readinessURL := fmt.Sprintf("http://%s:%d/readiness", host, port)
+			spare := worker.NewMockWorker(ctrl)
+			spare.EXPECT().String().Return("worker-b").AnyTimes()
+			m = NewMockManager(ctrl)
+			m.EXPECT().GetWorkerNames().Return([]string{"worker-a", "worker-b"}).AnyTimes()
+			pb = NewProbes(cfg, isStarted, stopping, m)
+			go pb.Serve(ctx)
+
+			setState(pb, workerA, worker.Status{State: worker.StateReady})
+			setState(pb, spare, worker.Status{State: worker.StateBooting, Spare: true})
+			Expect(waitForProbe(readinessURL, 3*time.Second)).To(Succeed())
+			Expect(readySpares(readinessURL)).To(Equal("0"))
+
+			setState(pb, spare, worker.Status{State: worker.StateReady, Spare: true})
+			Expect(readySpares(readinessURL)).To(Equal("1"))
 		})
 
 		It("responds on /liveness request", func() {
 			livenessURL := fmt.Sprintf("http://%s:%d/liveness", host, port)
 			go pb.Serve(ctx)
 
-			hc.EXPECT().GetServerState("worker-a").Return(connectivity.Ready)
+			setState(pb, workerA, worker.Status{State: worker.StateReady})
 			err := waitForProbe(livenessURL, 3*time.Second)
 			Expect(err).NotTo(HaveOccurred())
 
-			hc.EXPECT().GetServerState("worker-a").Return(connectivity.TransientFailure)
+			setState(pb, workerA, worker.Status{State: worker.StateUnhealthy})
 			err = waitForProbe(livenessURL, 100*time.Millisecond)
 			Expect(err).NotTo(HaveOccurred())
 
-			hc.EXPECT().GetServerState("worker-a").Return(connectivity.Shutdown)
+			setState(pb, workerA, worker.Status{State: worker.StateBackoff})
+			err = waitForProbe(livenessURL, 100*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+
+			setState(pb, workerA, worker.Status{State: worker.StateCrashLoop, CrashLooping: true})
 			err = waitForProbe(livenessURL, 100*time.Millisecond)
 			Expect(err).To(HaveOccurred())
 		})
+
+		It("fails /liveness only when all workers are crash looping", func() {
+			livenessURL := fmt.Sprintf("http://%s:%d/liveness", host, port)
+			workerB := worker.NewMockWorker(ctrl)
+			workerB.EXPECT().String().Return("worker-b").AnyTimes()
+			m = NewMockManager(ctrl)
+			m.EXPECT().GetWorkerNames().Return([]string{"worker-a", "worker-b"}).AnyTimes()
+			pb = NewProbes(cfg, isStarted, stopping, m)
+			go pb.Serve(ctx)
+
+			setState(pb, workerA, worker.Status{State: worker.StateCrashLoop, CrashLooping: true})
+			setState(pb, workerB, worker.Status{State: worker.StateReady})
+			Expect(waitForProbe(livenessURL, 3*time.Second)).To(Succeed())
+
+			setState(pb, workerB, worker.Status{State: worker.StateCrashLoop, CrashLooping: true})
+			Expect(waitForProbe(livenessURL, 100*time.Millisecond)).NotTo(Succeed())
+		})
 	})
 })
 
+func setState(pb *Probes, w worker.Worker, status worker.Status) {
+	pb.HandleEvent(worker.Event{Worker: w, Status: status})
+}
+
+func readySpares(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get(readySparesHeader), nil
+}
+
 func waitForProbe(url string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	var lastErr error
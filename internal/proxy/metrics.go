@@ -0,0 +1,13 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_request_retries_total",
+		Help: "Total number of requests replayed on a worker by method and the status code that caused the retry.",
+	}, []string{"method", "code"})
+)
@@ -4,8 +4,11 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
@@ -14,10 +17,15 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/loadbalance"
 	"github.com/bibendi/gruf-relay/internal/log"
 	"github.com/bibendi/gruf-relay/internal/worker"
 )
 
+// retryPushbackKey tells gRPC clients with a retry policy how long to wait before retrying.
+const retryPushbackKey = "grpc-retry-pushback-ms"
+
 var (
 	downstreamDescForProxying = &grpc.StreamDesc{
 		ServerStreams: true,
@@ -26,7 +34,7 @@ var (
 )
 
 type Balancer interface {
-	Next() worker.Worker
+	Dispatch(ctx context.Context) (worker.Worker, worker.PulledClientConn, error)
 }
 
 type PulledClientConn interface {
@@ -35,14 +43,14 @@ type PulledClientConn interface {
 }
 
 type Proxy struct {
-	Balancer       Balancer
-	requestTimeout time.Duration
+	Balancer Balancer
+	cfg      config.Server
 }
 
-func NewProxy(balancer Balancer, requestTimeout time.Duration) *Proxy {
+func NewProxy(balancer Balancer, cfg config.Server) *Proxy {
 	return &Proxy{
-		Balancer:       balancer,
-		requestTimeout: requestTimeout,
+		Balancer: balancer,
+		cfg:      cfg,
 	}
 }
 
@@ -55,38 +63,93 @@ func (p *Proxy) HandleRequest(srv any, upstream grpc.ServerStream) error {
 	}
 	log.Info("Handle gRPC request", slog.String("method", fullMethod))
 
-	worker := p.Balancer.Next()
-	log.Debug("Selected worker", slog.Any("worker", worker))
-	if worker == nil {
-		return status.Error(codes.Unavailable, "server unavailable")
+	// The timeout counts from the arrival of the request, so that the time spent
+	// in the queue comes out of the budget forwarded to the worker.
+	timeouts := resolveTimeouts(p.cfg, fullMethod)
+	timeoutCtx, cancel := timeouts.context(ctx)
+	defer cancel()
+
+	// Requests that may be retried are kept as they are forwarded to replay them
+	// on another worker.
+	policy := resolveRetryPolicy(p.cfg.RetryPolicies, fullMethod)
+	var request *requestBuffer
+	if policy != nil {
+		request = newRequestBuffer(upstream, fullMethod, p.cfg.RetryBuffer)
 	}
 
-	var client PulledClientConn
-	var err error
-	client, err = worker.FetchClientConn(ctx)
+	for attempt := 1; ; attempt++ {
+		trailer, replayable, err := p.forward(timeoutCtx, upstream, fullMethod, timeouts, request, attempt)
+		if replayable && request.replayable() {
+			if backoff, ok := retryBackoff(policy, attempt, status.Code(err)); ok {
+				log.Warn("Retrying request", slog.String("method", fullMethod), slog.Int("attempt", attempt),
+					slog.String("code", status.Code(err).String()), slog.Duration("backoff", backoff))
+				requestRetriesTotal.WithLabelValues(fullMethod, status.Code(err).String()).Inc()
+
+				select {
+				case <-time.After(backoff):
+					continue
+				case <-timeoutCtx.Done():
+					return status.FromContextError(timeoutCtx.Err()).Err()
+				}
+			}
+		}
+
+		if attempt > 1 {
+			trailer = metadata.Join(trailer, metadata.Pairs(previousAttemptsKey, strconv.Itoa(attempt-1)))
+		}
+		if trailer != nil {
+			upstream.SetTrailer(trailer)
+		}
+		return err
+	}
+}
+
+// forward proxies the request to a worker once. The request goes through the
+// request buffer when given, otherwise it is streamed from the client. A failed
+// request is replayable when the worker failed it before any response reached the
+// client.
+func (p *Proxy) forward(ctx context.Context, upstream grpc.ServerStream, fullMethod string, timeouts methodTimeouts, request *requestBuffer, attempt int) (metadata.MD, bool, error) {
+	worker, client, err := p.dispatch(ctx, upstream)
 	if err != nil {
-		return status.Errorf(codes.Unavailable, "failed getting grpc client connection: %v", err)
+		return nil, false, err
 	}
+	log.Debug("Selected worker", slog.Any("worker", worker))
 	defer client.Return()
-
-	timeoutCtx, cancel := context.WithTimeout(ctx, p.requestTimeout)
-	defer cancel()
+	worker.RecordRequest()
 
 	md, _ := metadata.FromIncomingContext(ctx)
-	outCtx := metadata.NewOutgoingContext(timeoutCtx, md.Copy())
+	md = md.Copy()
+	if attempt > 1 {
+		md.Set(previousAttemptsKey, strconv.Itoa(attempt-1))
+	}
+	outCtx := metadata.NewOutgoingContext(ctx, md)
 	log.Debug("Request metadata", slog.Any("metadata", md))
 	downstreamCtx, downstreamCancel := context.WithCancel(outCtx)
 	defer downstreamCancel()
+	idle := newIdleTimer(timeouts.Idle, downstreamCancel)
+	defer idle.stop()
 
 	downstream, err := grpc.NewClientStream(downstreamCtx, downstreamDescForProxying, client.Conn(), fullMethod)
 	if err != nil {
-		return status.Errorf(codes.Unavailable, "failed creating downstream: %v", err)
+		return nil, true, status.Errorf(codes.Unavailable, "failed creating downstream: %v", err)
 	}
 
-	log.Info("Proxying request", slog.String("method", fullMethod), slog.Any("worker", worker))
+	log.Info("Proxying request", slog.String("method", fullMethod), slog.Any("worker", worker), slog.Int("attempt", attempt))
 
-	upstreamErrChan := proxyRequest(upstream, downstream)
-	downstreamErrChan := proxyResponse(downstream, upstream)
+	var upstreamErrChan chan error
+	if request != nil {
+		upstreamErrChan = request.send(downstreamCtx, downstream, idle)
+		// The next attempt reads the request only after this one stopped reading it.
+		defer func(errChan chan error) {
+			downstreamCancel()
+			for range errChan {
+			}
+		}(upstreamErrChan)
+	} else {
+		upstreamErrChan = proxyRequest(upstream, downstream, idle)
+	}
+	var responded atomic.Bool
+	downstreamErrChan := proxyResponse(downstream, upstream, idle, &responded)
 
 	for {
 		select {
@@ -98,10 +161,10 @@ func (p *Proxy) HandleRequest(srv any, upstream grpc.ServerStream) error {
 
 			if err == io.EOF {
 				if err := downstream.CloseSend(); err != nil {
-					return status.Errorf(codes.Internal, "failed closing downstream: %v", err)
+					return nil, false, status.Errorf(codes.Internal, "failed closing downstream: %v", err)
 				}
 			} else {
-				return status.Errorf(codes.Internal, "failed proxying request: %v", err)
+				return nil, false, status.Errorf(codes.Internal, "failed proxying request: %v", err)
 			}
 		case err, ok := <-downstreamErrChan:
 			if !ok {
@@ -109,20 +172,54 @@ func (p *Proxy) HandleRequest(srv any, upstream grpc.ServerStream) error {
 				continue
 			}
 
-			upstream.SetTrailer(downstream.Trailer())
+			trailer := downstream.Trailer()
 
 			if err == io.EOF {
 				log.Info("Finish proxying", slog.String("method", fullMethod), slog.Any("worker", worker))
-				return nil
+				return trailer, false, nil
+			} else if idle.expired() {
+				log.Info("Stream idle timeout", slog.String("method", fullMethod), slog.Any("worker", worker), slog.Duration("idle_timeout", timeouts.Idle))
+				return trailer, false, status.Error(codes.DeadlineExceeded, "stream idle timeout exceeded")
 			} else {
 				log.Error("Failed proxy response", slog.Any("worker", worker), slog.Any("error", err))
-				return err
+				return trailer, !responded.Load() && ctx.Err() == nil, err
 			}
 		}
 	}
 }
 
-func proxyRequest(src grpc.ServerStream, dst grpc.ClientStream) chan error {
+// dispatch waits for a worker only while the request has more than minDeadline of
+// its deadline left, so that no worker gets a request nobody waits for anymore.
+// Requests that could not be dispatched fail with a status: shed requests are
+// rejected as RESOURCE_EXHAUSTED with a retry pushback.
+func (p *Proxy) dispatch(ctx context.Context, upstream grpc.ServerStream) (worker.Worker, worker.PulledClientConn, error) {
+	dispatchCtx := ctx
+	deadline, ok := ctx.Deadline()
+	if ok {
+		var cancel context.CancelFunc
+		dispatchCtx, cancel = context.WithDeadline(ctx, deadline.Add(-p.cfg.MinDeadline))
+		defer cancel()
+	}
+
+	w, conn, err := p.Balancer.Dispatch(dispatchCtx)
+	switch {
+	case err == nil:
+		return w, conn, nil
+	case dispatchCtx.Err() != nil:
+		log.Debug("Request dropped before dispatch", slog.Any("error", dispatchCtx.Err()), slog.Duration("remaining", time.Until(deadline)))
+		return nil, nil, status.FromContextError(dispatchCtx.Err()).Err()
+	case errors.Is(err, loadbalance.ErrQueueFull), errors.Is(err, loadbalance.ErrOverloaded):
+		log.Debug("Request shed", slog.Any("error", err))
+		if pushback := p.cfg.Queue.RetryPushback; pushback > 0 {
+			upstream.SetTrailer(metadata.Pairs(retryPushbackKey, strconv.FormatInt(pushback.Milliseconds(), 10)))
+		}
+		return nil, nil, status.Errorf(codes.ResourceExhausted, "server overloaded: %v", err)
+	default:
+		return nil, nil, status.Errorf(codes.Unavailable, "server unavailable: %v", err)
+	}
+}
+
+func proxyRequest(src grpc.ServerStream, dst grpc.ClientStream, idle *idleTimer) chan error {
 	errChan := make(chan error, 1)
 
 	go func() {
@@ -142,13 +239,16 @@ func proxyRequest(src grpc.ServerStream, dst grpc.ClientStream) chan error {
 				errChan <- err
 				return
 			}
+			idle.touch()
 		}
 	}()
 
 	return errChan
 }
 
-func proxyResponse(src grpc.ClientStream, dst grpc.ServerStream) chan error {
+// proxyResponse copies the response from the worker to the client and sets responded
+// before the first part of it is sent to the client.
+func proxyResponse(src grpc.ClientStream, dst grpc.ServerStream, idle *idleTimer, responded *atomic.Bool) chan error {
 	errChan := make(chan error, 1)
 
 	go func() {
@@ -169,6 +269,7 @@ func proxyResponse(src grpc.ClientStream, dst grpc.ServerStream) chan error {
 			errChan <- err
 			return
 		}
+		responded.Store(true)
 		if err := dst.SendHeader(header); err != nil {
 			errChan <- err
 			return
@@ -179,6 +280,7 @@ func proxyResponse(src grpc.ClientStream, dst grpc.ServerStream) chan error {
 			errChan <- err
 			return
 		}
+		idle.touch()
 
 		// Copy the remaining message stream.
 		for {
@@ -191,6 +293,7 @@ func proxyResponse(src grpc.ClientStream, dst grpc.ServerStream) chan error {
 				errChan <- err
 				return
 			}
+			idle.touch()
 		}
 	}()
 
@@ -10,6 +10,7 @@
 package proxy
 
 import (
+	context "context"
 	reflect "reflect"
 
 	worker "github.com/bibendi/gruf-relay/internal/worker"
@@ -41,18 +42,20 @@ func (m *MockBalancer) EXPECT() *MockBalancerMockRecorder {
 	return m.recorder
 }
 
-// Next mocks base method.
-func (m *MockBalancer) Next() worker.Worker {
+// Dispatch mocks base method.
+func (m *MockBalancer) Dispatch(ctx context.Context) (worker.Worker, worker.PulledClientConn, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Next")
+	ret := m.ctrl.Call(m, "Dispatch", ctx)
 	ret0, _ := ret[0].(worker.Worker)
-	return ret0
+	ret1, _ := ret[1].(worker.PulledClientConn)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
-// Next indicates an expected call of Next.
-func (mr *MockBalancerMockRecorder) Next() *gomock.Call {
+// Dispatch indicates an expected call of Dispatch.
+func (mr *MockBalancerMockRecorder) Dispatch(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Next", reflect.TypeOf((*MockBalancer)(nil).Next))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dispatch", reflect.TypeOf((*MockBalancer)(nil).Dispatch), ctx)
 }
 
 // MockPulledClientConn is a mock of PulledClientConn interface.
@@ -6,10 +6,13 @@ import (
 	"io"
 	"log"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/bibendi/gruf-relay/internal/codec"
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/loadbalance"
 	"github.com/bibendi/gruf-relay/internal/worker"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -21,6 +24,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestProxy(t *testing.T) {
@@ -33,6 +37,7 @@ var _ = Describe("Proxy", func() {
 		ctrl             *gomock.Controller
 		mockBalancer     *MockBalancer
 		proxy            *Proxy
+		serverCfg        config.Server
 		ctx              context.Context
 		cancel           context.CancelFunc
 		mockWorker       *worker.MockWorker
@@ -40,13 +45,23 @@ var _ = Describe("Proxy", func() {
 		clientConn       *grpc.ClientConn
 		pulledClient     *MockPulledClientConn
 		lis              *bufconn.Listener
+		failures         atomic.Int32
+		echo             atomic.Bool
+		previousAttempts atomic.Value
 	)
 
 	BeforeEach(func() {
 		ctrl = gomock.NewController(GinkgoT())
 		mockBalancer = NewMockBalancer(ctrl)
-		proxy = NewProxy(mockBalancer, 2*time.Second)
+		serverCfg = config.Server{
+			ProxyTimeout: config.Timeout(2 * time.Second),
+			MinDeadline:  100 * time.Millisecond,
+			Queue:        config.Queue{RetryPushback: 250 * time.Millisecond},
+		}
+		proxy = NewProxy(mockBalancer, serverCfg)
 		ctx, cancel = context.WithCancel(context.Background())
+		failures.Store(0)
+		echo.Store(false)
 		mockWorker = worker.NewMockWorker(ctrl)
 		mockServerStream = NewMockServerStream(ctrl)
 
@@ -61,6 +76,24 @@ var _ = Describe("Proxy", func() {
 		grpcServer := grpc.NewServer(
 			grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
 				log.Println("UnknownServiceHandler called")
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				previousAttempts.Store(md.Get("grpc-previous-rpc-attempts"))
+				var msg emptypb.Empty
+				for {
+					if err := stream.RecvMsg(&msg); err == io.EOF {
+						break
+					} else if err != nil {
+						return err
+					}
+					if echo.Load() {
+						if err := stream.SendMsg(&msg); err != nil {
+							return err
+						}
+					}
+				}
+				if failures.Add(-1) >= 0 {
+					return status.Error(codes.Unavailable, "worker is restarting")
+				}
 				return nil
 			}),
 		)
@@ -114,30 +147,166 @@ var _ = Describe("Proxy", func() {
 
 	Describe("HandleRequest", func() {
 		It("should handle the request", func() {
-			mockBalancer.EXPECT().Next().Return(mockWorker).Times(1)
-			mockWorker.EXPECT().FetchClientConn(gomock.Any()).Return(pulledClient, nil).Times(1)
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(mockWorker, pulledClient, nil).Times(1)
+			mockWorker.EXPECT().RecordRequest().Times(1)
 			mockServerStream.EXPECT().RecvMsg(gomock.Any()).Return(io.EOF).Times(1)
 			mockServerStream.EXPECT().SetTrailer(gomock.Any()).Times(1)
 
 			Expect(proxy.HandleRequest(nil, mockServerStream)).To(BeNil())
 		})
 
-		It("Return server unavailable when the balancer returns nil", func() {
-			mockBalancer.EXPECT().Next().Return(nil).Times(1)
+		It("Return server unavailable when the request can't be dispatched", func() {
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(nil, nil, errors.New("Test error")).Times(1)
+
 			err := proxy.HandleRequest(nil, mockServerStream)
 
 			Expect(status.Code(err)).To(Equal(codes.Unavailable))
 			Expect(err).ToNot(BeNil())
 		})
 
-		It("Return error when can't get client", func() {
-			mockBalancer.EXPECT().Next().Return(mockWorker).Times(1)
-			mockWorker.EXPECT().FetchClientConn(gomock.Any()).Return(nil, errors.New("Test error")).Times(1)
+		It("Return resource exhausted with a retry pushback when the request is shed", func() {
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(nil, nil, loadbalance.ErrQueueFull).Times(1)
+			mockServerStream.EXPECT().SetTrailer(metadata.Pairs("grpc-retry-pushback-ms", "250")).Times(1)
 
 			err := proxy.HandleRequest(nil, mockServerStream)
 
-			Expect(status.Code(err)).To(Equal(codes.Unavailable))
-			Expect(err).ToNot(BeNil())
+			Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		})
+
+		It("Waits for a worker only while the request has more than the minimum deadline left", func() {
+			startedAt := time.Now()
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).DoAndReturn(func(ctx context.Context) (worker.Worker, worker.PulledClientConn, error) {
+				deadline, ok := ctx.Deadline()
+				Expect(ok).To(BeTrue())
+				Expect(deadline).To(BeTemporally("~", startedAt.Add(1900*time.Millisecond), 50*time.Millisecond))
+				return nil, nil, errors.New("Test error")
+			}).Times(1)
+
+			Expect(proxy.HandleRequest(nil, mockServerStream)).NotTo(Succeed())
+		})
+
+		It("Return deadline exceeded when the deadline runs out before dispatch", func() {
+			serverCfg.ProxyTimeout = config.Timeout(50 * time.Millisecond)
+			proxy = NewProxy(mockBalancer, serverCfg)
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).DoAndReturn(func(ctx context.Context) (worker.Worker, worker.PulledClientConn, error) {
+				<-ctx.Done()
+				return nil, nil, ctx.Err()
+			}).Times(1)
+
+			err := proxy.HandleRequest(nil, mockServerStream)
+
+			Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+		})
+
+		It("Does not bound requests of methods without a timeout", func() {
+			serverCfg.MethodTimeouts = []config.MethodTimeout{{Method: "/test.Service/*", Default: config.NoTimeout}}
+			proxy = NewProxy(mockBalancer, serverCfg)
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).DoAndReturn(func(ctx context.Context) (worker.Worker, worker.PulledClientConn, error) {
+				_, ok := ctx.Deadline()
+				Expect(ok).To(BeFalse())
+				return nil, nil, errors.New("Test error")
+			}).Times(1)
+
+			Expect(proxy.HandleRequest(nil, mockServerStream)).NotTo(Succeed())
+		})
+
+		Context("with a retry policy", func() {
+			expectRequest := func(messages int) {
+				calls := make([]any, 0, messages+1)
+				for range messages {
+					calls = append(calls, mockServerStream.EXPECT().RecvMsg(gomock.Any()).Return(nil))
+				}
+				calls = append(calls, mockServerStream.EXPECT().RecvMsg(gomock.Any()).Return(io.EOF))
+				gomock.InOrder(calls...)
+			}
+
+			BeforeEach(func() {
+				serverCfg.RetryPolicies = []config.RetryPolicy{{
+					Method:            "/test.Service/*",
+					MaxAttempts:       3,
+					RetryableCodes:    []config.Code{config.Code(codes.Unavailable)},
+					InitialBackoff:    time.Millisecond,
+					MaxBackoff:        time.Millisecond,
+					BackoffMultiplier: 2,
+				}}
+				serverCfg.RetryBuffer = config.RetryBuffer{MaxMessages: 2, MaxSize: 1024}
+				proxy = NewProxy(mockBalancer, serverCfg)
+			})
+
+			It("replays the request on another worker when a worker fails it before responding", func() {
+				expectRequest(2)
+				failures.Store(2)
+				mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(mockWorker, pulledClient, nil).Times(3)
+				mockWorker.EXPECT().RecordRequest().Times(3)
+				mockServerStream.EXPECT().SetTrailer(gomock.Any()).Do(func(md metadata.MD) {
+					Expect(md.Get("grpc-previous-rpc-attempts")).To(Equal([]string{"2"}))
+				}).Times(1)
+
+				Expect(proxy.HandleRequest(nil, mockServerStream)).To(Succeed())
+				Expect(previousAttempts.Load()).To(Equal([]string{"2"}))
+			})
+
+			It("gives up after the max attempts", func() {
+				expectRequest(1)
+				failures.Store(3)
+				mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(mockWorker, pulledClient, nil).Times(3)
+				mockWorker.EXPECT().RecordRequest().Times(3)
+				mockServerStream.EXPECT().SetTrailer(gomock.Any()).Times(1)
+
+				err := proxy.HandleRequest(nil, mockServerStream)
+
+				Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			})
+
+			It("does not retry requests that could not be dispatched", func() {
+				mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(nil, nil, errors.New("Test error")).Times(1)
+
+				err := proxy.HandleRequest(nil, mockServerStream)
+
+				Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			})
+
+			It("does not retry requests that exceed the retry buffer", func() {
+				expectRequest(3)
+				failures.Store(1)
+				mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(mockWorker, pulledClient, nil).Times(1)
+				mockWorker.EXPECT().RecordRequest().Times(1)
+				mockServerStream.EXPECT().SetTrailer(gomock.Any()).Times(1)
+
+				err := proxy.HandleRequest(nil, mockServerStream)
+
+				Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			})
+
+			It("streams the request to the worker before the client closes its side", func() {
+				echo.Store(true)
+				responded := make(chan struct{})
+				gomock.InOrder(
+					mockServerStream.EXPECT().RecvMsg(gomock.Any()).Return(nil),
+					mockServerStream.EXPECT().RecvMsg(gomock.Any()).DoAndReturn(func(any) error {
+						<-responded
+						return io.EOF
+					}),
+				)
+				mockBalancer.EXPECT().Dispatch(gomock.Any()).Return(mockWorker, pulledClient, nil).Times(1)
+				mockWorker.EXPECT().RecordRequest().Times(1)
+				mockServerStream.EXPECT().SendHeader(gomock.Any()).Times(1)
+				mockServerStream.EXPECT().SendMsg(gomock.Any()).Do(func(any) { close(responded) }).Times(1)
+				mockServerStream.EXPECT().SetTrailer(gomock.Any()).Times(1)
+
+				Expect(proxy.HandleRequest(nil, mockServerStream)).To(Succeed())
+			})
+		})
+
+		It("Return the context error when the client gives up while queued", func() {
+			mockBalancer.EXPECT().Dispatch(gomock.Any()).DoAndReturn(func(ctx context.Context) (worker.Worker, worker.PulledClientConn, error) {
+				cancel()
+				return nil, nil, ctx.Err()
+			}).Times(1)
+
+			err := proxy.HandleRequest(nil, mockServerStream)
+
+			Expect(status.Code(err)).To(Equal(codes.Canceled))
 		})
 	})
 })
@@ -150,3 +319,99 @@ type testServerTransportStream struct {
 func (t *testServerTransportStream) Method() string {
 	return t.method
 }
+
+var _ = Describe("Timeouts", func() {
+	cfg := config.Server{
+		ProxyTimeout:      config.Timeout(5 * time.Second),
+		MaxTimeout:        config.Timeout(time.Minute),
+		StreamIdleTimeout: config.NoTimeout,
+		MethodTimeouts: []config.MethodTimeout{
+			{Method: "/export.Exports/Stream", Default: config.NoTimeout, Max: config.NoTimeout, Idle: config.Timeout(30 * time.Second)},
+			{Method: "export.Exports/*", Default: config.Timeout(time.Minute)},
+			{Method: "/lookup.*/*", Max: config.Timeout(time.Second)},
+		},
+	}
+
+	DescribeTable("resolveTimeouts",
+		func(method string, expected methodTimeouts) {
+			Expect(resolveTimeouts(cfg, method)).To(Equal(expected))
+		},
+		Entry("server timeouts", "/users.Users/Get", methodTimeouts{Default: 5 * time.Second, Max: time.Minute}),
+		Entry("full method name", "/export.Exports/Stream", methodTimeouts{Idle: 30 * time.Second}),
+		Entry("service glob without a leading slash", "/export.Exports/List", methodTimeouts{Default: time.Minute, Max: time.Minute}),
+		Entry("package glob", "/lookup.Cities/Find", methodTimeouts{Default: 5 * time.Second, Max: time.Second}),
+	)
+
+	DescribeTable("context",
+		func(timeouts methodTimeouts, clientTimeout, expected time.Duration) {
+			ctx := context.Background()
+			if clientTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, clientTimeout)
+				defer cancel()
+			}
+
+			startedAt := time.Now()
+			ctx, cancel := timeouts.context(ctx)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if expected == 0 {
+				Expect(ok).To(BeFalse())
+				return
+			}
+			Expect(deadline).To(BeTemporally("~", startedAt.Add(expected), 10*time.Millisecond))
+		},
+		Entry("default without a client deadline", methodTimeouts{Default: 5 * time.Second}, time.Duration(0), 5*time.Second),
+		Entry("client deadline over the default", methodTimeouts{Default: 5 * time.Second}, 10*time.Second, 10*time.Second),
+		Entry("client deadline capped by max", methodTimeouts{Max: time.Second}, 10*time.Second, time.Second),
+		Entry("client deadline below max", methodTimeouts{Max: time.Minute}, 10*time.Second, 10*time.Second),
+		Entry("default capped by max", methodTimeouts{Default: 5 * time.Second, Max: time.Second}, time.Duration(0), time.Second),
+		Entry("no timeout", methodTimeouts{}, time.Duration(0), time.Duration(0)),
+	)
+
+	DescribeTable("retryBackoff",
+		func(attempt int, code codes.Code, expected time.Duration, retry bool) {
+			policy := &config.RetryPolicy{
+				MaxAttempts:       4,
+				RetryableCodes:    []config.Code{config.Code(codes.Unavailable)},
+				InitialBackoff:    100 * time.Millisecond,
+				MaxBackoff:        300 * time.Millisecond,
+				BackoffMultiplier: 2,
+			}
+			backoff, ok := retryBackoff(policy, attempt, code)
+			Expect(ok).To(Equal(retry))
+			Expect(backoff).To(Equal(expected))
+		},
+		Entry("first retry", 1, codes.Unavailable, 100*time.Millisecond, true),
+		Entry("growing backoff", 2, codes.Unavailable, 200*time.Millisecond, true),
+		Entry("capped backoff", 3, codes.Unavailable, 300*time.Millisecond, true),
+		Entry("attempts exhausted", 4, codes.Unavailable, time.Duration(0), false),
+		Entry("code not retryable", 1, codes.Internal, time.Duration(0), false),
+	)
+
+	Describe("idleTimer", func() {
+		It("cancels the stream when no message passed for the idle timeout", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			idle := newIdleTimer(50*time.Millisecond, cancel)
+			defer idle.stop()
+
+			for range 3 {
+				time.Sleep(25 * time.Millisecond)
+				idle.touch()
+			}
+			Expect(ctx.Err()).NotTo(HaveOccurred())
+			Expect(idle.expired()).To(BeFalse())
+
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(idle.expired()).To(BeTrue())
+		})
+
+		It("never fires without an idle timeout", func() {
+			idle := newIdleTimer(0, func() {})
+			idle.touch()
+			idle.stop()
+			Expect(idle.expired()).To(BeFalse())
+		})
+	})
+})
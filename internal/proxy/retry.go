@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+	"github.com/bibendi/gruf-relay/internal/log"
+)
+
+// previousAttemptsKey tells a worker and the client how many times a request was
+// attempted before, like gRPC clients do for their own retries.
+const previousAttemptsKey = "grpc-previous-rpc-attempts"
+
+// resolveRetryPolicy returns the first retry policy that matches the method, if any.
+func resolveRetryPolicy(policies []config.RetryPolicy, method string) *config.RetryPolicy {
+	for i := range policies {
+		if matchMethod(policies[i].Method, method) {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+// retryBackoff returns how long to wait before the next attempt, if the request
+// may be retried after it failed with code in the given attempt.
+func retryBackoff(policy *config.RetryPolicy, attempt int, code codes.Code) (time.Duration, bool) {
+	if policy == nil || attempt >= policy.MaxAttempts || !slices.Contains(policy.RetryableCodes, config.Code(code)) {
+		return 0, false
+	}
+
+	backoff := float64(policy.InitialBackoff) * math.Pow(policy.BackoffMultiplier, float64(attempt-1))
+	return min(time.Duration(backoff), policy.MaxBackoff), true
+}
+
+// requestBuffer reads the request from the client once for all attempts. It
+// forwards the messages as they arrive, so that streaming clients need not close
+// their side before a worker responds, and keeps them to replay the request on the
+// next attempt. Requests that exceed the retry buffer caps are not kept and so are
+// not retried. Attempts use the buffer one at a time.
+type requestBuffer struct {
+	src         grpc.ServerStream
+	method      string
+	maxMessages int
+	maxSize     int
+
+	messages   []*emptypb.Empty
+	size       int
+	overflowed bool
+	pending    chan received
+	err        error
+}
+
+// received is the result of reading a message from the client.
+type received struct {
+	msg *emptypb.Empty
+	err error
+}
+
+func newRequestBuffer(src grpc.ServerStream, method string, cfg config.RetryBuffer) *requestBuffer {
+	return &requestBuffer{
+		src:         src,
+		method:      method,
+		maxMessages: cfg.MaxMessages,
+		maxSize:     int(cfg.MaxSize),
+	}
+}
+
+// replayable tells whether the whole request read so far is kept for a retry.
+func (b *requestBuffer) replayable() bool {
+	return b != nil && !b.overflowed
+}
+
+// send replays the kept messages and then forwards those the client sends next. It
+// reports io.EOF once the client closed its side, like proxyRequest does, and
+// stops quietly when ctx is done, leaving a pending read to the next attempt.
+func (b *requestBuffer) send(ctx context.Context, dst grpc.ClientStream, idle *idleTimer) chan error {
+	errChan := make(chan error, 1)
+	replay := slices.Clone(b.messages)
+
+	go func() {
+		defer close(errChan)
+
+		for _, msg := range replay {
+			if err := dst.SendMsg(msg); err != nil {
+				errChan <- err
+				return
+			}
+			idle.touch()
+		}
+
+		for {
+			msg, err := b.next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					errChan <- err
+				}
+				return
+			}
+
+			if err := dst.SendMsg(msg); err != nil {
+				errChan <- err
+				return
+			}
+			idle.touch()
+		}
+	}()
+
+	return errChan
+}
+
+// next reads the next message from the client and keeps it. A read outlives the
+// attempt that started it when ctx is done first, as the stream of the client can
+// only be read by one goroutine at a time.
+func (b *requestBuffer) next(ctx context.Context) (*emptypb.Empty, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if b.pending == nil {
+		b.pending = make(chan received, 1)
+		go func(pending chan<- received) {
+			msg := &emptypb.Empty{}
+			err := b.src.RecvMsg(msg)
+			pending <- received{msg: msg, err: err}
+		}(b.pending)
+	}
+
+	select {
+	case r := <-b.pending:
+		b.pending = nil
+		if r.err != nil {
+			b.err = r.err
+			return nil, r.err
+		}
+		b.keep(r.msg)
+		return r.msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// keep adds the message to the replay buffer until the request exceeds a cap, then
+// drops the buffer for good.
+func (b *requestBuffer) keep(msg *emptypb.Empty) {
+	if b.overflowed {
+		return
+	}
+
+	b.size += proto.Size(msg)
+	if len(b.messages) >= b.maxMessages || b.size > b.maxSize {
+		log.Debug("Request exceeds the retry buffer, it will not be retried", slog.String("method", b.method),
+			slog.Int("max_messages", b.maxMessages), slog.Int("max_size", b.maxSize))
+		b.overflowed = true
+		b.messages = nil
+		return
+	}
+	b.messages = append(b.messages, msg)
+}
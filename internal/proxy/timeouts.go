@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+)
+
+// methodTimeouts are the timeouts of a method, zero meaning that there is none.
+type methodTimeouts struct {
+	Default time.Duration
+	Max     time.Duration
+	Idle    time.Duration
+}
+
+// resolveTimeouts returns the timeouts of the method from the first method timeout
+// that matches it, falling back to the server timeouts for those it does not set.
+func resolveTimeouts(cfg config.Server, method string) methodTimeouts {
+	timeouts := methodTimeouts{
+		Default: cfg.ProxyTimeout.Duration(),
+		Max:     cfg.MaxTimeout.Duration(),
+		Idle:    cfg.StreamIdleTimeout.Duration(),
+	}
+
+	for _, mt := range cfg.MethodTimeouts {
+		if !matchMethod(mt.Method, method) {
+			continue
+		}
+		if mt.Default != 0 {
+			timeouts.Default = mt.Default.Duration()
+		}
+		if mt.Max != 0 {
+			timeouts.Max = mt.Max.Duration()
+		}
+		if mt.Idle != 0 {
+			timeouts.Idle = mt.Idle.Duration()
+		}
+		break
+	}
+	return timeouts
+}
+
+// matchMethod tells whether the full method name matches a method name or glob,
+// with or without the leading slash.
+func matchMethod(pattern, method string) bool {
+	ok, _ := path.Match("/"+strings.TrimPrefix(pattern, "/"), method)
+	return ok
+}
+
+// context bounds the request by the client deadline, or by the default timeout when
+// the client set none, and caps either by the max timeout.
+func (t methodTimeouts) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := t.Default
+	if _, ok := ctx.Deadline(); ok {
+		timeout = 0
+	}
+	if t.Max > 0 && (timeout == 0 || t.Max < timeout) {
+		timeout = t.Max
+	}
+
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// idleTimer cancels a stream that passed no message in either direction for the
+// idle timeout. A nil timer never fires.
+type idleTimer struct {
+	timer   *time.Timer
+	timeout time.Duration
+	fired   atomic.Bool
+}
+
+func newIdleTimer(timeout time.Duration, cancel context.CancelFunc) *idleTimer {
+	if timeout <= 0 {
+		return nil
+	}
+
+	t := &idleTimer{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.fired.Store(true)
+		cancel()
+	})
+	return t
+}
+
+// touch restarts the timeout after a message.
+func (t *idleTimer) touch() {
+	if t != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t != nil {
+		t.timer.Stop()
+	}
+}
+
+// expired tells whether the stream was cancelled for being idle.
+func (t *idleTimer) expired() bool {
+	return t != nil && t.fired.Load()
+}
@@ -21,16 +21,18 @@ type Proxy interface {
 }
 
 type Server struct {
-	host  string
-	port  int
-	proxy Proxy
+	host            string
+	port            int
+	shutdownTimeout time.Duration
+	proxy           Proxy
 }
 
 func NewServer(cfg config.Server, proxy Proxy) *Server {
 	return &Server{
-		host:  cfg.Host,
-		port:  cfg.Port,
-		proxy: proxy,
+		host:            cfg.Host,
+		port:            cfg.Port,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		proxy:           proxy,
 	}
 }
 
@@ -69,8 +71,28 @@ func (s *Server) Serve(ctx context.Context) error {
 	case err := <-errChan:
 		return err
 	case <-ctx.Done():
-		log.Info("Stopping gRPC server")
-		server.GracefulStop()
+		s.gracefulStop(server)
 	}
 	return nil
 }
+
+// gracefulStop stops accepting new connections and waits for in-flight requests
+// to finish, closing the remaining connections after the shutdown timeout.
+func (s *Server) gracefulStop(server *grpc.Server) {
+	log.Info("Stopping gRPC server", slog.Duration("timeout", s.shutdownTimeout))
+
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("gRPC server stopped")
+	case <-time.After(s.shutdownTimeout):
+		log.Warn("Timeout waiting for in-flight requests, closing gRPC server")
+		server.Stop()
+		<-done
+	}
+}
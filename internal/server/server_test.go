@@ -9,6 +9,9 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestServer(t *testing.T) {
@@ -67,6 +70,35 @@ var _ = Describe("Server", func() {
 			Eventually(ctx.Done()).Should(BeClosed())
 		})
 
+		It("should close in-flight requests after the shutdown timeout", func() {
+			cfg.ShutdownTimeout = 100 * time.Millisecond
+			server = NewServer(cfg, mockProxy)
+
+			started := make(chan struct{})
+			mockProxy.EXPECT().HandleRequest(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, stream grpc.ServerStream) error {
+				close(started)
+				<-stream.Context().Done()
+				return stream.Context().Err()
+			})
+
+			served := make(chan error, 1)
+			go func() {
+				served <- server.Serve(ctx)
+			}()
+
+			conn, err := grpc.NewClient("localhost:6024", grpc.WithTransportCredentials(insecure.NewCredentials()))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(conn.Close)
+
+			go func() {
+				_ = conn.Invoke(context.Background(), "/test.Service/Call", &emptypb.Empty{}, &emptypb.Empty{}, grpc.WaitForReady(true))
+			}()
+
+			Eventually(started).Should(BeClosed())
+			cancel()
+			Eventually(served).WithTimeout(time.Second).Should(Receive(BeNil()))
+		})
+
 		It("should handle listen error", func() {
 			cfg.Port = -1 // Provoke error
 			server = NewServer(cfg, mockProxy)
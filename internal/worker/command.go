@@ -7,17 +7,24 @@ import (
 	"os"
 	"os/exec"
 	"syscall"
+	"time"
 )
 
+// commandWaitDelay bounds how long Wait keeps copying output of an exited process,
+// so that descendants holding its output pipes open do not block it.
+const commandWaitDelay = time.Second
+
 type Command interface {
 	Start() error
 	Wait() error
-	Stop() error
+	Stop(sig syscall.Signal) error
 	Kill() error
 	ProcessState() *os.ProcessState
+	Pid() int
 	SetStdout(io.Writer)
 	SetStderr(io.Writer)
 	SetEnv([]string)
+	SetDir(string)
 }
 
 type DefaultCommand struct {
@@ -34,6 +41,8 @@ func (d *DefaultCommandExecutor) NewCommand(name string, arg ...string) Command
 	cmd := exec.Command(name, arg...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = sysProcAttr()
+	cmd.WaitDelay = commandWaitDelay
 	return &DefaultCommand{cmd: cmd}
 }
 
@@ -42,25 +51,48 @@ func (d *DefaultCommand) Start() error {
 	if errors.Is(d.cmd.Err, exec.ErrDot) {
 		d.cmd.Err = nil
 	}
-	return d.cmd.Start()
+	if err := d.cmd.Start(); err != nil {
+		return err
+	}
+	commandPids.Store(d.cmd.Process.Pid, true)
+	return nil
 }
 
+// Wait waits for the command to exit and kills the processes it left behind in its group.
 func (d *DefaultCommand) Wait() error {
-	return d.cmd.Wait()
+	err := d.cmd.Wait()
+	_ = d.signalGroup(syscall.SIGKILL)
+	commandPids.Delete(d.cmd.Process.Pid)
+	return err
 }
 
-func (d *DefaultCommand) Stop() error {
-	return d.cmd.Process.Signal(syscall.SIGTERM)
+// Stop asks the command to exit by sending sig to its process group.
+func (d *DefaultCommand) Stop(sig syscall.Signal) error {
+	return d.signalGroup(sig)
 }
 
 func (d *DefaultCommand) Kill() error {
-	return d.cmd.Process.Kill()
+	return d.signalGroup(syscall.SIGKILL)
+}
+
+// signalGroup signals the whole process group of the command, so that
+// wrappers and forked children do not outlive it.
+func (d *DefaultCommand) signalGroup(sig syscall.Signal) error {
+	return syscall.Kill(-d.cmd.Process.Pid, sig)
 }
 
 func (d *DefaultCommand) ProcessState() *os.ProcessState {
 	return d.cmd.ProcessState
 }
 
+// Pid returns the process id of the started command or zero if it has not been started.
+func (d *DefaultCommand) Pid() int {
+	if d.cmd.Process == nil {
+		return 0
+	}
+	return d.cmd.Process.Pid
+}
+
 func (d *DefaultCommand) SetStdout(w io.Writer) {
 	d.cmd.Stdout = w
 }
@@ -72,3 +104,8 @@ func (d *DefaultCommand) SetStderr(w io.Writer) {
 func (d *DefaultCommand) SetEnv(env []string) {
 	d.cmd.Env = env
 }
+
+// SetDir sets the working directory of the command, an empty one keeps the directory of the relay.
+func (d *DefaultCommand) SetDir(dir string) {
+	d.cmd.Dir = dir
+}
@@ -0,0 +1,22 @@
+package worker
+
+import "syscall"
+
+const prSetChildSubreaper = 36
+
+// sysProcAttr starts the worker in its own process group and makes the kernel
+// terminate it when the relay dies.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGTERM,
+	}
+}
+
+// setSubreaper makes orphaned descendants of the relay be reparented to it instead of to init.
+func setSubreaper() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
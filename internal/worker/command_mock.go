@@ -13,6 +13,7 @@ import (
 	io "io"
 	os "os"
 	reflect "reflect"
+	syscall "syscall"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -55,6 +56,20 @@ func (mr *MockCommandMockRecorder) Kill() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Kill", reflect.TypeOf((*MockCommand)(nil).Kill))
 }
 
+// Pid mocks base method.
+func (m *MockCommand) Pid() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pid")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Pid indicates an expected call of Pid.
+func (mr *MockCommandMockRecorder) Pid() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pid", reflect.TypeOf((*MockCommand)(nil).Pid))
+}
+
 // ProcessState mocks base method.
 func (m *MockCommand) ProcessState() *os.ProcessState {
 	m.ctrl.T.Helper()
@@ -69,6 +84,18 @@ func (mr *MockCommandMockRecorder) ProcessState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessState", reflect.TypeOf((*MockCommand)(nil).ProcessState))
 }
 
+// SetDir mocks base method.
+func (m *MockCommand) SetDir(arg0 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetDir", arg0)
+}
+
+// SetDir indicates an expected call of SetDir.
+func (mr *MockCommandMockRecorder) SetDir(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDir", reflect.TypeOf((*MockCommand)(nil).SetDir), arg0)
+}
+
 // SetEnv mocks base method.
 func (m *MockCommand) SetEnv(arg0 []string) {
 	m.ctrl.T.Helper()
@@ -120,17 +147,17 @@ func (mr *MockCommandMockRecorder) Start() *gomock.Call {
 }
 
 // Stop mocks base method.
-func (m *MockCommand) Stop() error {
+func (m *MockCommand) Stop(sig syscall.Signal) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Stop")
+	ret := m.ctrl.Call(m, "Stop", sig)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Stop indicates an expected call of Stop.
-func (mr *MockCommandMockRecorder) Stop() *gomock.Call {
+func (mr *MockCommandMockRecorder) Stop(sig any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockCommand)(nil).Stop))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockCommand)(nil).Stop), sig)
 }
 
 // Wait mocks base method.
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package worker
+
+import (
+	"errors"
+	"syscall"
+)
+
+// sysProcAttr starts the worker in its own process group. Parent death signals are Linux only.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+func setSubreaper() error {
+	return errors.New("subreaper is only supported on Linux")
+}
@@ -2,9 +2,12 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bibendi/gruf-relay/internal/log"
 	"google.golang.org/grpc"
@@ -15,11 +18,24 @@ type PulledClientConn interface {
 	Return()
 }
 
+// ErrPoolExhausted is returned when every connection of the pool is in use.
+var ErrPoolExhausted = errors.New("no free connection in pool")
+
+// PoolStats is a snapshot of the connection pool usage.
+type PoolStats struct {
+	Size  int
+	InUse int
+}
+
 type clientConnBuilder func() (*grpc.ClientConn, error)
 
+const idlePollInterval = 50 * time.Millisecond
+
 type connectionPool struct {
 	connections []*grpc.ClientConn
+	health      *grpc.ClientConn
 	available   chan int
+	inUse       atomic.Int64
 	mu          sync.Mutex
 	log         log.Logger
 	builder     clientConnBuilder
@@ -46,16 +62,19 @@ func newConnectionPool(size int, logger log.Logger, builder clientConnBuilder) *
 	return &pool
 }
 
-func (cp *connectionPool) fetchConn(ctx context.Context) (*pooledClientConn, error) {
+// fetchConn pulls a free connection without waiting. Requests wait for a free
+// connection in the queue of the load balancer instead.
+func (cp *connectionPool) fetchConn() (*pooledClientConn, error) {
 	var idx int
 	select {
 	case idx = <-cp.available:
 		cp.log.Debug("Got connection from pool", slog.Int("index", idx))
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	default:
+		return nil, ErrPoolExhausted
 	}
 
 	if cp.connections[idx] != nil {
+		cp.inUse.Add(1)
 		return newPooledClientConn(idx, cp), nil
 	}
 
@@ -71,9 +90,48 @@ func (cp *connectionPool) fetchConn(ctx context.Context) (*pooledClientConn, err
 		cp.connections[idx] = client
 	}
 
+	cp.inUse.Add(1)
 	return newPooledClientConn(idx, cp), nil
 }
 
+// healthConn returns the connection kept for health checks next to the pooled ones,
+// so that health checks never wait for a busy pool.
+func (cp *connectionPool) healthConn() (*grpc.ClientConn, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.health == nil {
+		client, err := cp.builder()
+		if err != nil {
+			return nil, fmt.Errorf("failed creating new gRPC client connection: %v", err)
+		}
+		cp.health = client
+	}
+	return cp.health, nil
+}
+
+// waitIdle blocks until all pulled connections are returned to the pool.
+func (cp *connectionPool) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+
+	for cp.inUse.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (cp *connectionPool) stats() PoolStats {
+	return PoolStats{
+		Size:  cap(cp.available),
+		InUse: int(cp.inUse.Load()),
+	}
+}
+
 func (cp *connectionPool) close() {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
@@ -86,6 +144,13 @@ func (cp *connectionPool) close() {
 			cp.connections[i] = nil
 		}
 	}
+
+	if cp.health != nil {
+		if err := cp.health.Close(); err != nil {
+			cp.log.Error("Failed to close health check connection", slog.Any("error", err))
+		}
+		cp.health = nil
+	}
 }
 
 func newPooledClientConn(idx int, cp *connectionPool) *pooledClientConn {
@@ -103,5 +168,6 @@ func (pcc *pooledClientConn) Conn() *grpc.ClientConn {
 
 func (pcc *pooledClientConn) Return() {
 	pcc.log.Debug("Returning connection to pool", slog.Int("index", pcc.index))
+	pcc.pool.inUse.Add(-1)
 	pcc.pool.available <- pcc.index
 }
@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ExitReason classifies why a worker process exited.
+type ExitReason string
+
+const (
+	// ExitReasonClean is a process that exited with code zero.
+	ExitReasonClean ExitReason = "clean"
+	// ExitReasonCode is a process that exited with a non-zero code.
+	ExitReasonCode ExitReason = "exit_code"
+	// ExitReasonSignal is a process that was killed by a signal.
+	ExitReasonSignal ExitReason = "signal"
+	// ExitReasonOOM is a process that was likely killed by the kernel for running out of memory.
+	ExitReasonOOM ExitReason = "oom"
+	// ExitReasonKilled is a process that was killed by the relay, e.g. after the boot timeout.
+	ExitReasonKilled ExitReason = "killed"
+)
+
+// maxTailLine limits the length of a line kept in the output tail.
+const maxTailLine = 1024
+
+// OutputLine is a line written by a worker process.
+type OutputLine struct {
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+}
+
+// CrashReport describes an unexpected exit of a worker process.
+type CrashReport struct {
+	Worker    string       `json:"worker"`
+	PID       int          `json:"pid"`
+	Reason    ExitReason   `json:"reason"`
+	ExitCode  int          `json:"exit_code"`
+	Signal    string       `json:"signal,omitempty"`
+	KilledBy  string       `json:"killed_by,omitempty"`
+	OOMKills  int64        `json:"oom_kills,omitempty"`
+	StartedAt time.Time    `json:"started_at"`
+	ExitedAt  time.Time    `json:"exited_at"`
+	Restarts  int          `json:"restarts"`
+	Output    []OutputLine `json:"output"`
+}
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// classifyExit tells why a process exited from its exit status, the reason the relay
+// killed it for, if any, and the number of OOM kills in its cgroup while it ran, if
+// known. Only a SIGKILL the relay did not send is taken for an OOM kill. The cgroup
+// is shared with the relay and other workers, so its OOM kills merely confirm that
+// the SIGKILL came from the OOM killer.
+func classifyExit(code int, signal, killReason string, oomKills int64, oomKnown bool) ExitReason {
+	switch {
+	case killReason != "":
+		return ExitReasonKilled
+	case signal == syscall.SIGKILL.String() && (oomKills > 0 || !oomKnown):
+		return ExitReasonOOM
+	case signal != "":
+		return ExitReasonSignal
+	case code != 0:
+		return ExitReasonCode
+	default:
+		return ExitReasonClean
+	}
+}
+
+// outputTail keeps the last lines a worker process wrote to stdout and stderr.
+type outputTail struct {
+	mu    sync.Mutex
+	lines []OutputLine
+	size  int
+}
+
+func newOutputTail(size int) *outputTail {
+	return &outputTail{size: size}
+}
+
+// writer returns a writer that adds the lines written to it to the tail.
+func (t *outputTail) writer(stream string) *tailWriter {
+	return &tailWriter{tail: t, stream: stream}
+}
+
+func (t *outputTail) add(stream string, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.lines) == t.size {
+		t.lines = slices.Delete(t.lines, 0, 1)
+	}
+	t.lines = append(t.lines, OutputLine{Stream: stream, Text: text})
+}
+
+func (t *outputTail) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = nil
+}
+
+func (t *outputTail) snapshot() []OutputLine {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.lines)
+}
+
+// tailWriter splits the output of a stream into lines for the tail.
+type tailWriter struct {
+	tail   *outputTail
+	stream string
+	buf    []byte
+}
+
+func (tw *tailWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			tw.append(p)
+			break
+		}
+
+		tw.append(p[:i])
+		tw.flush()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (tw *tailWriter) append(p []byte) {
+	tw.buf = append(tw.buf, p[:min(len(p), maxTailLine-len(tw.buf))]...)
+}
+
+// flush adds the partial last line to the tail.
+func (tw *tailWriter) flush() {
+	if line := string(bytes.TrimSuffix(tw.buf, []byte("\r"))); strings.TrimSpace(line) != "" {
+		tw.tail.add(tw.stream, line)
+	}
+	tw.buf = tw.buf[:0]
+}
+
+// readOOMKills returns the number of processes killed by the OOM killer in the
+// cgroup v2 the relay runs in. Workers share the cgroup of the relay.
+func readOOMKills() (int64, bool) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "self", "cgroup"))
+	if err != nil {
+		return 0, false
+	}
+
+	var path string
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "0::"); ok {
+			path = rest
+			break
+		}
+	}
+	if path == "" {
+		return 0, false
+	}
+
+	f, err := os.Open(filepath.Join(cgroupRoot, path, "memory.events"))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "oom_kill "); ok {
+			count, err := strconv.ParseInt(value, 10, 64)
+			return count, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/bibendi/gruf-relay/internal/log"
+)
+
+// Event is a transition of a worker from one state to another, or a change of its role
+// within the same state. Status.State is the new state.
+type Event struct {
+	Worker Worker
+	From   State
+	Status Status
+}
+
+// EventHandler consumes worker state transitions. Handlers are called synchronously
+// in the order of transitions, so they must be quick and must not call back into the worker.
+type EventHandler func(Event)
+
+// EventBus delivers worker state transitions to subscribers. A nil bus drops events.
+type EventBus struct {
+	mu       sync.Mutex
+	handlers []EventHandler
+	last     map[string]Event
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{last: make(map[string]Event)}
+}
+
+// Subscribe registers the handler and replays the last transition of every
+// known worker to it, so that late subscribers start from the current states.
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+	for _, e := range b.last {
+		handler(e)
+	}
+}
+
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last[e.Worker.String()] = e
+	for _, handler := range b.handlers {
+		handler(e)
+	}
+}
+
+// LogEvent logs a worker state transition or a change of the worker role.
+func LogEvent(e Event) {
+	attrs := []any{
+		slog.Any("worker", e.Worker),
+		slog.String("from", e.From.String()),
+		slog.String("to", e.Status.State.String()),
+		slog.String("reason", e.Status.Reason),
+	}
+
+	if e.Status.Spare {
+		attrs = append(attrs, slog.Bool("spare", true))
+	}
+
+	switch e.Status.State {
+	case e.From:
+		log.Info("Worker role changed", slog.Any("worker", e.Worker), slog.String("state", e.From.String()), slog.Bool("spare", e.Status.Spare), slog.Bool("crash_looping", e.Status.CrashLooping))
+	case StateExited:
+		attrs = append(attrs, slog.Int("exit_code", e.Status.ExitCode), slog.String("exit_signal", e.Status.ExitSignal))
+		log.Info("Worker state changed", attrs...)
+	case StateBackoff, StateCrashLoop:
+		attrs = append(attrs, slog.Int("restarts", e.Status.Restarts))
+		log.Warn("Worker state changed", attrs...)
+	case StateUnhealthy:
+		log.Warn("Worker state changed", attrs...)
+	default:
+		log.Info("Worker state changed", attrs...)
+	}
+}
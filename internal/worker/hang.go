@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxDumpSize limits the output captured from a hung worker.
+const maxDumpSize = 1 << 20
+
+type hangConfig struct {
+	timeouts    int
+	dumpSignal  syscall.Signal
+	dumpTimeout time.Duration
+}
+
+// outputCapture passes the output of a worker through and records it while a dump is captured.
+type outputCapture struct {
+	out io.Writer
+	mu  sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.buf != nil {
+		c.buf.Write(p[:min(len(p), maxDumpSize-c.buf.Len())])
+	}
+	c.mu.Unlock()
+	return c.out.Write(p)
+}
+
+func (c *outputCapture) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = &bytes.Buffer{}
+}
+
+// stop returns the output recorded since start.
+func (c *outputCapture) stop() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dump := c.buf.String()
+	c.buf = nil
+	return dump
+}
+
+// ReportTimeout marks the worker unhealthy after a health check that timed out. A running
+// worker that keeps timing out is considered hung: its dump is captured and it is restarted.
+func (w *workerImpl) ReportTimeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state := w.status.State
+	if state != StateReady && state != StateUnhealthy {
+		return
+	}
+
+	w.reportHealth(false, "health check timed out")
+	w.timeouts++
+	if w.hang.timeouts <= 0 || w.timeouts < w.hang.timeouts || w.killReason != "" {
+		return
+	}
+
+	w.killReason = RestartReasonHung
+	go w.dumpAndKill(w.cmd, w.stderr, w.timeouts)
+}
+
+// dumpAndKill asks a hung worker process to dump its threads, logs what it wrote
+// to stderr within the dump timeout and kills it. The worker is then restarted
+// like after any other unexpected exit.
+func (w *workerImpl) dumpAndKill(cmd Command, stderr *outputCapture, timeouts int) {
+	w.log.Error("Worker is hung, capturing a dump",
+		slog.Int("timeouts", timeouts),
+		slog.String("signal", w.hang.dumpSignal.String()),
+		slog.Duration("dump_timeout", w.hang.dumpTimeout))
+
+	stderr.start()
+	if err := cmd.Stop(w.hang.dumpSignal); err != nil {
+		w.log.Error("Failed to send dump signal to worker", slog.Any("error", err))
+	}
+	time.Sleep(w.hang.dumpTimeout)
+	dump := stderr.stop()
+
+	w.log.Error("Worker dump", slog.Int("pid", cmd.Pid()), slog.Int("size", len(dump)), slog.String("dump", dump))
+
+	w.mu.Lock()
+	// The process has exited or is being stopped in the meantime.
+	if w.cmd != cmd || !w.status.State.IsRunning() {
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+
+	if err := cmd.Kill(); err != nil {
+		w.log.Error("Failed to kill worker", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	restartsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_worker_restarts_total",
+		Help: "Total number of worker restarts performed by the relay.",
+	}, []string{"worker", "reason"})
+
+	residentMemory = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gruf_relay_worker_resident_memory_bytes",
+		Help: "Resident memory size of the worker process in bytes.",
+	}, []string{"worker"})
+
+	crashLooping = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gruf_relay_worker_crash_looping",
+		Help: "Whether the worker is in a crash loop (1) or not (0).",
+	}, []string{"worker"})
+
+	crashesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_worker_crashes_total",
+		Help: "Total number of unexpected worker exits by exit reason.",
+	}, []string{"worker", "reason"})
+
+	workerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gruf_relay_worker_state",
+		Help: "Current lifecycle state of the worker (1 for the current state, 0 otherwise).",
+	}, []string{"worker", "state"})
+
+	workerSpare = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gruf_relay_worker_spare",
+		Help: "Whether the worker is a hot standby spare (1) or an active worker (0).",
+	}, []string{"worker"})
+
+	stateTransitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gruf_relay_worker_state_transitions_total",
+		Help: "Total number of worker lifecycle state transitions.",
+	}, []string{"worker", "from", "to"})
+)
+
+// DeleteMetrics removes the per-worker series of a worker that was removed, so that
+// its last state is not exported anymore. Counters are kept, as they only grow.
+func DeleteMetrics(name string) {
+	labels := prometheus.Labels{"worker": name}
+	workerState.DeletePartialMatch(labels)
+	residentMemory.DeletePartialMatch(labels)
+	crashLooping.DeletePartialMatch(labels)
+	workerSpare.DeletePartialMatch(labels)
+}
+
+// RecordEvent updates the worker state metrics on a state transition or a change of the worker role.
+func RecordEvent(e Event) {
+	name := e.Worker.String()
+	for _, state := range States {
+		value := 0.0
+		if state == e.Status.State {
+			value = 1
+		}
+		workerState.WithLabelValues(name, state.String()).Set(value)
+	}
+	spare := 0.0
+	if e.Status.Spare {
+		spare = 1
+	}
+	workerSpare.WithLabelValues(name).Set(spare)
+
+	if e.From != e.Status.State {
+		stateTransitionsTotal.WithLabelValues(name, e.From.String(), e.Status.State.String()).Inc()
+	}
+}
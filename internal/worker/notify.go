@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// NotifySocketEnv is the environment variable that holds the path of the notify socket,
+// following the sd_notify convention.
+const NotifySocketEnv = "NOTIFY_SOCKET"
+
+const (
+	notifyReasonReady    = "notified ready"
+	notifyReasonStopping = "notified stopping"
+	notifyReasonWatchdog = "notify watchdog timeout"
+
+	// maxNotifyMessage is the size of the largest datagram read from the notify socket.
+	maxNotifyMessage = 4096
+)
+
+// listenNotify opens the datagram socket a worker process sends its notifications to.
+func listenNotify(path string) (*net.UnixConn, error) {
+	return net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+}
+
+// serveNotify reads notifications of the process started by cmd until conn is closed.
+// Every datagram holds newline separated KEY=VALUE assignments.
+func (w *workerImpl) serveNotify(cmd Command, conn *net.UnixConn) {
+	buf := make([]byte, maxNotifyMessage)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				w.log.Error("Failed to read from notify socket", slog.Any("error", err))
+			}
+			return
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				w.handleNotify(cmd, key, value)
+			}
+		}
+	}
+}
+
+// handleNotify applies a single notification of the process started by cmd.
+func (w *workerImpl) handleNotify(cmd Command, key, value string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Late notifications of a previous process are dropped.
+	if w.cmd != cmd {
+		return
+	}
+
+	switch key {
+	case "READY":
+		if value == "1" && !w.notifyStopping {
+			w.reportHealth(true, notifyReasonReady)
+		}
+	case "STOPPING":
+		if value == "1" {
+			w.notifyStopping = true
+			w.reportHealth(false, notifyReasonStopping)
+		}
+	case "STATUS":
+		w.status.Message = value
+		w.log.Info("Worker status", slog.String("status", value))
+	case "WATCHDOG":
+		if value != "1" {
+			return
+		}
+		w.status.Watchdog = time.Now()
+		if w.watchdogTimeout <= 0 {
+			return
+		}
+		if w.watchdogTimer == nil {
+			w.watchdogTimer = time.AfterFunc(w.watchdogTimeout, func() { w.checkWatchdog(cmd) })
+		} else {
+			w.watchdogTimer.Reset(w.watchdogTimeout)
+		}
+		if w.status.State == StateUnhealthy && w.status.Reason == notifyReasonWatchdog {
+			w.reportHealth(true, "notify watchdog recovered")
+		}
+	default:
+		w.log.Debug("Unknown notification", slog.String("key", key), slog.String("value", value))
+	}
+}
+
+// checkWatchdog marks a worker unhealthy once it has not pinged the watchdog within the timeout.
+func (w *workerImpl) checkWatchdog(cmd Command) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cmd != cmd || time.Since(w.status.Watchdog) < w.watchdogTimeout {
+		return
+	}
+
+	w.log.Warn("Worker missed notify watchdog", slog.Time("last_ping", w.status.Watchdog), slog.Duration("timeout", w.watchdogTimeout))
+	w.reportHealth(false, notifyReasonWatchdog)
+}
+
+// closeNotify stops listening to the notifications of the current process. The caller must hold w.mu.
+func (w *workerImpl) closeNotify() {
+	if w.watchdogTimer != nil {
+		w.watchdogTimer.Stop()
+		w.watchdogTimer = nil
+	}
+	if w.notifyConn != nil {
+		w.notifyConn.Close()
+		w.notifyConn = nil
+	}
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bibendi/gruf-relay/internal/log"
+)
+
+// outputLevels maps the levels written by common Ruby loggers to log levels.
+var outputLevels = map[string]slog.Level{
+	"trace":   slog.LevelDebug,
+	"debug":   slog.LevelDebug,
+	"info":    slog.LevelInfo,
+	"warn":    slog.LevelWarn,
+	"warning": slog.LevelWarn,
+	"error":   slog.LevelError,
+	"fatal":   slog.LevelError,
+}
+
+// outputReservedKeys are fields of JSON lines that are replaced by the relay log record.
+var outputReservedKeys = []string{"time", "timestamp", "level", "severity", "msg", "message", "worker", "stream"}
+
+// outputLogger re-emits the output of a worker process line by line through the
+// logger. JSON lines are merged into the log record as fields. Lines longer than
+// maxLine are truncated, and a partial last line is emitted on flush.
+type outputLogger struct {
+	log       log.Logger
+	stream    string
+	maxLine   int
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func newOutputLogger(logger log.Logger, stream string, maxLine int) *outputLogger {
+	return &outputLogger{log: logger, stream: stream, maxLine: maxLine}
+}
+
+func (o *outputLogger) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			o.append(p)
+			break
+		}
+
+		o.append(p[:i])
+		o.emit()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// flush emits the partial last line of an exited process.
+func (o *outputLogger) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.buf) > 0 || o.truncated {
+		o.emit()
+	}
+}
+
+// append buffers a part of the current line, dropping what does not fit into maxLine.
+func (o *outputLogger) append(p []byte) {
+	if room := o.maxLine - len(o.buf); len(p) > room {
+		p = p[:room]
+		o.truncated = true
+	}
+	o.buf = append(o.buf, p...)
+}
+
+func (o *outputLogger) emit() {
+	line := string(bytes.TrimSuffix(o.buf, []byte("\r")))
+	truncated := o.truncated
+	o.buf = o.buf[:0]
+	o.truncated = false
+
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	level, msg := slog.LevelInfo, line
+	attrs := []any{slog.String("stream", o.stream)}
+	if truncated {
+		attrs = append(attrs, slog.Bool("truncated", true))
+	}
+
+	var fields map[string]any
+	if !truncated && strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &fields) == nil {
+		level, msg = parsedLevel(fields), parsedMessage(fields)
+		for _, key := range slices.Sorted(maps.Keys(fields)) {
+			if !slices.Contains(outputReservedKeys, key) {
+				attrs = append(attrs, slog.Any(key, fields[key]))
+			}
+		}
+	}
+
+	o.log.Log(context.Background(), level, msg, attrs...)
+}
+
+func parsedLevel(fields map[string]any) slog.Level {
+	for _, key := range []string{"level", "severity"} {
+		if name, ok := fields[key].(string); ok {
+			if level, ok := outputLevels[strings.ToLower(name)]; ok {
+				return level
+			}
+		}
+	}
+	return slog.LevelInfo
+}
+
+func parsedMessage(fields map[string]any) string {
+	for _, key := range []string{"message", "msg"} {
+		if msg, ok := fields[key].(string); ok {
+			return msg
+		}
+	}
+	return ""
+}
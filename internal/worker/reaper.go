@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/bibendi/gruf-relay/internal/log"
+)
+
+// commandPids holds the processes started by DefaultCommand. They are waited
+// for by their commands, so the reaper must leave them alone.
+var commandPids sync.Map
+
+// RunReaper collects exited processes reparented to the relay, such as orphaned
+// children of workers when the relay runs as PID 1 in a container.
+func RunReaper(ctx context.Context) {
+	if err := setSubreaper(); err != nil {
+		log.Warn("Failed to become a subreaper", slog.Any("error", err))
+	}
+
+	log.Info("Starting orphan reaper")
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGCHLD)
+	defer signal.Stop(sigChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping orphan reaper")
+			return
+		case <-sigChan:
+			reapOrphans(os.Getpid())
+		}
+	}
+}
+
+// reapOrphans waits for exited children of pid that were not started as workers.
+func reapOrphans(pid int) {
+	for _, child := range childPids(pid) {
+		if _, ok := commandPids.Load(child); ok {
+			continue
+		}
+
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(child, &status, syscall.WNOHANG, nil)
+		if err != nil || reaped <= 0 {
+			continue
+		}
+		log.Debug("Reaped orphaned process", slog.Int("pid", reaped), slog.Int("exit_status", status.ExitStatus()))
+	}
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/bibendi/gruf-relay/internal/config"
+)
+
+// defaultRestartPolicy keeps the historical behaviour of restarting every second
+// without crash loop detection when no policy is configured.
+var defaultRestartPolicy = config.Restart{
+	InitialDelay: time.Second,
+	MaxDelay:     time.Second,
+	Multiplier:   1,
+	StableUptime: time.Minute,
+}
+
+type restartPolicy struct {
+	cfg      config.Restart
+	attempt  int
+	restarts []time.Time
+}
+
+func newRestartPolicy(cfg config.Restart) *restartPolicy {
+	return &restartPolicy{cfg: cfg}
+}
+
+// nextDelay returns the delay before the next restart and advances the backoff.
+func (p *restartPolicy) nextDelay() time.Duration {
+	delay := float64(p.cfg.InitialDelay) * math.Pow(p.cfg.Multiplier, float64(p.attempt))
+	delay = math.Min(delay, float64(p.cfg.MaxDelay))
+	if p.cfg.Jitter > 0 {
+		delay += delay * p.cfg.Jitter * (rand.Float64()*2 - 1)
+	}
+	p.attempt++
+	return time.Duration(delay)
+}
+
+// recordRestart registers a restart and reports whether the worker is crash looping.
+func (p *restartPolicy) recordRestart(now time.Time) bool {
+	if p.cfg.CrashLoopRestarts <= 0 {
+		return false
+	}
+
+	windowStart := now.Add(-p.cfg.CrashLoopWindow)
+	restarts := p.restarts[:0]
+	for _, t := range p.restarts {
+		if t.After(windowStart) {
+			restarts = append(restarts, t)
+		}
+	}
+	p.restarts = append(restarts, now)
+
+	return len(p.restarts) >= p.cfg.CrashLoopRestarts
+}
+
+func (p *restartPolicy) reset() {
+	p.attempt = 0
+	p.restarts = nil
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var procRoot = "/proc"
+
+// readRSS returns the resident set size of the process in bytes, optionally
+// including all of its descendants.
+func readRSS(pid int, includeChildren bool) (int64, error) {
+	rss, err := readProcessRSS(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	if !includeChildren {
+		return rss, nil
+	}
+
+	for _, child := range childPids(pid) {
+		childRSS, err := readRSS(child, true)
+		if err != nil {
+			// The child may have exited in the meantime.
+			continue
+		}
+		rss += childRSS
+	}
+	return rss, nil
+}
+
+func readProcessRSS(pid int) (int64, error) {
+	// smaps_rollup is more accurate but is not available on older kernels.
+	if rss, err := readKiBField(filepath.Join(procRoot, strconv.Itoa(pid), "smaps_rollup"), "Rss:"); err == nil {
+		return rss, nil
+	}
+	return readKiBField(filepath.Join(procRoot, strconv.Itoa(pid), "status"), "VmRSS:")
+}
+
+func readKiBField(path, field string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, field) {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, field))
+		if len(fields) == 0 {
+			break
+		}
+		kib, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %s in %s: %w", field, path, err)
+		}
+		return kib * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s not found in %s", field, path)
+}
+
+func childPids(pid int) []int {
+	tasks, err := os.ReadDir(filepath.Join(procRoot, strconv.Itoa(pid), "task"))
+	if err != nil {
+		return nil
+	}
+
+	var children []int
+	for _, task := range tasks {
+		data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "task", task.Name(), "children"))
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if child, err := strconv.Atoi(field); err == nil {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// State is a stage of the worker lifecycle.
+type State int
+
+const (
+	// StateNew is a worker that has not been started yet.
+	StateNew State = iota
+	// StateStarting is a worker whose process is being spawned.
+	StateStarting
+	// StateBooting is a worker whose process runs but has not passed a health check yet.
+	StateBooting
+	// StateReady is a worker that passes health checks and receives requests.
+	StateReady
+	// StateUnhealthy is a worker that failed a health check after it was ready.
+	StateUnhealthy
+	// StateDraining is a worker that left the balancer and finishes in-flight requests.
+	StateDraining
+	// StateStopping is a worker that was sent the stop signal and is exiting.
+	StateStopping
+	// StateExited is a worker whose process has exited.
+	StateExited
+	// StateBackoff is a worker waiting to be restarted after an unexpected exit.
+	StateBackoff
+	// StateCrashLoop is a worker waiting to be restarted after exiting too often.
+	StateCrashLoop
+)
+
+var stateNames = [...]string{
+	StateNew:       "new",
+	StateStarting:  "starting",
+	StateBooting:   "booting",
+	StateReady:     "ready",
+	StateUnhealthy: "unhealthy",
+	StateDraining:  "draining",
+	StateStopping:  "stopping",
+	StateExited:    "exited",
+	StateBackoff:   "backoff",
+	StateCrashLoop: "crash_loop",
+}
+
+// States lists every state in lifecycle order.
+var States = []State{
+	StateNew, StateStarting, StateBooting, StateReady, StateUnhealthy,
+	StateDraining, StateStopping, StateExited, StateBackoff, StateCrashLoop,
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// IsRunning reports whether the worker process is up and not being stopped.
+func (s State) IsRunning() bool {
+	return s == StateBooting || s == StateReady || s == StateUnhealthy
+}
+
+// hasProcess reports whether the worker process may still be alive.
+func (s State) hasProcess() bool {
+	return s.IsRunning() || s == StateDraining || s == StateStopping
+}
+
+// Status is a snapshot of the worker lifecycle.
+type Status struct {
+	State State
+	// Since is the time the worker entered State.
+	Since time.Time
+	// Reason explains why the worker entered State.
+	Reason string
+	// StartedAt is the time the current or last process was started.
+	StartedAt time.Time
+	// Restarts counts the processes started after the first one.
+	Restarts int
+	// CrashLooping stays set from a crash loop until the worker has been up for the stable uptime.
+	CrashLooping bool
+	// ExitCode is the exit code of the last process, or -1 when it was killed by a signal or is unknown.
+	ExitCode int
+	// ExitSignal is the signal that killed the last process.
+	ExitSignal string
+	// Message is the last STATUS= text the process sent to the notify socket.
+	Message string
+	// Watchdog is the time the process last pinged the notify watchdog.
+	Watchdog time.Time
+	// Spare is set while the worker is a hot standby kept out of rotation.
+	Spare bool
+}
+
+// exitStatus extracts the exit code and the terminating signal from the result of Command.Wait.
+func exitStatus(err error) (int, string) {
+	if err == nil {
+		return 0, ""
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return -1, ""
+	}
+
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return -1, ws.Signal().String()
+	}
+	return exitErr.ExitCode(), ""
+}
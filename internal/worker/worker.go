@@ -3,13 +3,24 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/bibendi/gruf-relay/internal/codec"
+	"github.com/bibendi/gruf-relay/internal/config"
 	"github.com/bibendi/gruf-relay/internal/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -18,27 +29,104 @@ import (
 type Worker interface {
 	Run(context.Context) error
 	IsRunning() bool
+	IsCrashLooping() bool
 	String() string
 	Addr() string
 	MetricsAddr() string
-	FetchClientConn(ctx context.Context) (PulledClientConn, error)
+	MetricsSocket() string
+	NotifySocket() string
+	FetchClientConn() (PulledClientConn, error)
+	HealthCheckConn() (*grpc.ClientConn, error)
+	RecordRequest()
+	Recycle(reason string) <-chan struct{}
+	PoolStats() PoolStats
+	Status() Status
+	CrashReports() []CrashReport
+	ReportHealth(healthy bool, reason string)
+	ReportTimeout()
+	SetSpare(spare bool)
 }
 
+const (
+	RestartReasonExit           = "exit"
+	RestartReasonMaxRequests    = "max_requests"
+	RestartReasonMaxRSS         = "max_rss"
+	RestartReasonRollingRestart = "rolling_restart"
+	RestartReasonBootTimeout    = "boot_timeout"
+	RestartReasonHung           = "hung"
+	RestartReasonStartFailed    = "start_failed"
+
+	defaultDrainTimeout    = 30 * time.Second
+	defaultShutdownTimeout = 5 * time.Second
+)
+
 type workerImpl struct {
-	Name        string
-	addr        string
-	port        int
-	metricsPort int
-	metricsPath string
-	poolSize    int
-	log         log.Logger
-	connPool    *connectionPool
-	cmd         Command
-	mu          sync.Mutex
-	running     bool
-	stopping    bool
-	cmdDoneChan chan error
-	cmdExecutor CommandExecutor
+	Name            string
+	index           int
+	addr            string
+	port            int
+	metricsPort     int
+	metricsPath     string
+	socket          string
+	metricsSock     string
+	notifySock      string
+	poolSize        int
+	command         []string
+	env             map[string]string
+	dir             string
+	log             log.Logger
+	connPool        *connectionPool
+	cmd             Command
+	mu              sync.Mutex
+	status          Status
+	events          *EventBus
+	stableTimer     *time.Timer
+	bootTimeout     time.Duration
+	bootTimer       *time.Timer
+	killReason      string
+	restart         *restartPolicy
+	pendingRestart  chan struct{}
+	cmdDoneChan     chan error
+	cmdExecutor     CommandExecutor
+	drainTimeout    time.Duration
+	stopTimeout     time.Duration
+	stopSignal      syscall.Signal
+	notifyConn      *net.UnixConn
+	notifyStopping  bool
+	watchdogTimeout time.Duration
+	watchdogTimer   *time.Timer
+	hang            hangConfig
+	timeouts        int
+	stderr          *outputCapture
+	maxLineLength   int
+	outputs         []*outputLogger
+	tail            *outputTail
+	tailWriters     []*tailWriter
+	oomKills        int64
+	oomKnown        bool
+	crashes         []CrashReport
+	keepCrashes     int
+	recycleChan     chan *recycleRequest
+	recycling       *recycleRequest
+	stopped         bool
+	maxRequests     int
+	maxJitter       int
+	requests        atomic.Int64
+	requestLimit    atomic.Int64
+	rss             rssConfig
+	rssExceeded     time.Time
+}
+
+type recycleRequest struct {
+	reason string
+	done   chan struct{}
+}
+
+type rssConfig struct {
+	interval        time.Duration
+	includeChildren bool
+	limit           int64
+	sustain         time.Duration
 }
 
 type Option func(*workerImpl)
@@ -49,6 +137,135 @@ func WithExecutor(executor CommandExecutor) Option {
 	}
 }
 
+// WithRestartPolicy configures the backoff and crash loop detection used when the worker process exits.
+func WithRestartPolicy(cfg config.Restart) Option {
+	return func(w *workerImpl) {
+		w.restart = newRestartPolicy(cfg)
+	}
+}
+
+// WithEvents publishes the state transitions of the worker on the bus.
+func WithEvents(events *EventBus) Option {
+	return func(w *workerImpl) {
+		w.events = events
+	}
+}
+
+// WithBootTimeout kills and restarts a worker that has not passed a health check
+// within timeout after its process was started. Zero disables the timeout.
+func WithBootTimeout(timeout time.Duration) Option {
+	return func(w *workerImpl) {
+		w.bootTimeout = timeout
+	}
+}
+
+// WithShutdown configures how the worker is stopped: it waits up to drainTimeout
+// for in-flight requests, sends stopSignal and kills the process group when it
+// has not exited within shutdownTimeout.
+func WithShutdown(drainTimeout, shutdownTimeout time.Duration, stopSignal syscall.Signal) Option {
+	return func(w *workerImpl) {
+		w.drainTimeout = drainTimeout
+		w.stopTimeout = shutdownTimeout
+		w.stopSignal = stopSignal
+	}
+}
+
+// WithMaxRequests makes the worker recycle itself after serving maxRequests plus
+// a random number of up to jitter requests. Zero disables recycling.
+func WithMaxRequests(maxRequests, jitter int) Option {
+	return func(w *workerImpl) {
+		w.maxRequests = maxRequests
+		w.maxJitter = jitter
+	}
+}
+
+// WithRSSSampling samples the resident memory of the worker process every interval.
+func WithRSSSampling(interval time.Duration, includeChildren bool) Option {
+	return func(w *workerImpl) {
+		w.rss.interval = interval
+		w.rss.includeChildren = includeChildren
+	}
+}
+
+// WithMaxRSS makes the worker recycle itself once its resident memory stays
+// above limit bytes for the sustain period. Zero limit disables recycling.
+func WithMaxRSS(limit int64, sustain time.Duration) Option {
+	return func(w *workerImpl) {
+		w.rss.limit = limit
+		w.rss.sustain = sustain
+	}
+}
+
+// WithIndex sets the zero-based position of the worker exposed as {{.Index}} to templates.
+func WithIndex(index int) Option {
+	return func(w *workerImpl) {
+		w.index = index
+	}
+}
+
+// WithUnixSocket makes the worker listen on unix sockets in dir instead of TCP ports.
+func WithUnixSocket(dir string) Option {
+	return func(w *workerImpl) {
+		w.socket = filepath.Join(dir, w.Name+".sock")
+		w.metricsSock = filepath.Join(dir, w.Name+"-metrics.sock")
+		w.addr = "unix:" + w.socket
+	}
+}
+
+// WithNotifySocket makes the worker listen for notifications of its process on a
+// datagram socket in dir instead of being health checked. Once the process has
+// pinged the watchdog, it is reported unhealthy when it does not ping again within
+// watchdogTimeout. Zero disables the watchdog.
+func WithNotifySocket(dir string, watchdogTimeout time.Duration) Option {
+	return func(w *workerImpl) {
+		w.notifySock = filepath.Join(dir, w.Name+"-notify.sock")
+		w.watchdogTimeout = watchdogTimeout
+	}
+}
+
+// WithHangWatchdog kills and restarts a running worker after the given number of
+// consecutive health check timeouts. Before that, it sends dumpSignal and logs what
+// the worker writes to stderr within dumpTimeout. Zero timeouts disable the watchdog.
+func WithHangWatchdog(timeouts int, dumpSignal syscall.Signal, dumpTimeout time.Duration) Option {
+	return func(w *workerImpl) {
+		w.hang = hangConfig{timeouts: timeouts, dumpSignal: dumpSignal, dumpTimeout: dumpTimeout}
+	}
+}
+
+// WithOutputLogging re-emits the stdout and stderr of the worker process line by line
+// through the relay logger instead of passing them through. Lines are truncated to maxLineLength.
+func WithOutputLogging(maxLineLength int) Option {
+	return func(w *workerImpl) {
+		w.maxLineLength = maxLineLength
+	}
+}
+
+// WithCrashReports keeps the last outputLines lines of the worker output for crash
+// reports and the last keep reports for introspection.
+func WithCrashReports(outputLines, keep int) Option {
+	return func(w *workerImpl) {
+		if outputLines > 0 {
+			w.tail = newOutputTail(outputLines)
+		}
+		w.keepCrashes = keep
+	}
+}
+
+// WithDir starts the worker process in dir instead of the working directory of the relay.
+func WithDir(dir string) Option {
+	return func(w *workerImpl) {
+		w.dir = dir
+	}
+}
+
+// WithCommand sets the command and extra environment templates used to start the worker process.
+func WithCommand(command []string, env map[string]string) Option {
+	return func(w *workerImpl) {
+		w.command = command
+		w.env = env
+	}
+}
+
 func NewWorker(name string, port, metricsPort int, metricsPath string, poolSize int, opts ...Option) *workerImpl {
 	logger := log.With(slog.String("worker", name))
 	addr := fmt.Sprintf("0.0.0.0:%d", port)
@@ -60,24 +277,34 @@ func NewWorker(name string, port, metricsPort int, metricsPath string, poolSize
 		metricsPort: metricsPort,
 		metricsPath: metricsPath,
 		poolSize:    poolSize,
-		cmdDoneChan: make(chan error, 1),
+		recycleChan: make(chan *recycleRequest, 1),
 		log:         logger,
-		connPool: newConnectionPool(poolSize, logger, func() (*grpc.ClientConn, error) {
-			return grpc.NewClient(
-				addr,
-				grpc.WithTransportCredentials(insecure.NewCredentials()),
-				grpc.WithDefaultCallOptions(grpc.ForceCodec(codec.Codec())))
-		}),
+		status:      Status{State: StateNew, Since: time.Now(), ExitCode: -1},
+
+		drainTimeout: defaultDrainTimeout,
+		stopTimeout:  defaultShutdownTimeout,
+		stopSignal:   syscall.SIGTERM,
 	}
 
 	for _, opt := range opts {
 		opt(w)
 	}
 
+	w.connPool = newConnectionPool(poolSize, logger, func() (*grpc.ClientConn, error) {
+		return grpc.NewClient(
+			w.addr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(codec.Codec())))
+	})
+
 	if w.cmdExecutor == nil {
 		w.cmdExecutor = &DefaultCommandExecutor{}
 	}
 
+	if w.restart == nil {
+		w.restart = newRestartPolicy(defaultRestartPolicy)
+	}
+
 	return w
 }
 
@@ -89,156 +316,717 @@ func (w *workerImpl) Addr() string {
 	return w.addr
 }
 
+// MetricsAddr returns the host and path of the metrics endpoint. With unix sockets
+// the host is only a placeholder and connections go to MetricsSocket.
 func (w *workerImpl) MetricsAddr() string {
+	if w.metricsSock != "" {
+		return "localhost" + w.metricsPath
+	}
 	return fmt.Sprintf("0.0.0.0:%d%s", w.metricsPort, w.metricsPath)
 }
 
+// MetricsSocket returns the unix socket of the metrics endpoint, or an empty string for TCP.
+func (w *workerImpl) MetricsSocket() string {
+	return w.metricsSock
+}
+
+// NotifySocket returns the socket the worker process notifies its readiness to,
+// or an empty string when the worker is health checked instead.
+func (w *workerImpl) NotifySocket() string {
+	return w.notifySock
+}
+
 func (w *workerImpl) Run(ctx context.Context) error {
-	if err := w.start(); err != nil {
+	defer w.stopRecycling()
+
+	if err := w.start(ctx, "initial start"); err != nil {
 		return err
 	}
 
-	<-ctx.Done()
-	if err := w.shutdown(); err != nil {
-		w.log.Error("Failed to shutdown worker", slog.Any("error", err))
-		return err
+	var rssTick <-chan time.Time
+	if w.rss.interval > 0 {
+		ticker := time.NewTicker(w.rss.interval)
+		defer ticker.Stop()
+		rssTick = ticker.C
+	}
+
+	for {
+		select {
+		case req := <-w.recycleChan:
+			w.recycle(ctx, req.reason)
+			w.finishRecycle()
+		case <-rssTick:
+			w.checkRSS()
+		case <-ctx.Done():
+			if err := w.shutdown(ctx, "relay shutdown"); err != nil {
+				w.log.Error("Failed to shutdown worker", slog.Any("error", err))
+				return err
+			}
+			return nil
+		}
+	}
+}
+
+// Recycle asks the worker to drain and restart its process. The returned channel
+// is closed once the worker has been restarted or stopped, right away when it has
+// already stopped. Requests made while recycling is pending are merged into the
+// pending one.
+func (w *workerImpl) Recycle(reason string) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		w.log.Debug("Worker is stopped, not recycling", slog.String("reason", reason))
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	if w.recycling != nil {
+		w.log.Debug("Worker recycling is already pending", slog.String("reason", reason))
+		return w.recycling.done
+	}
+
+	req := &recycleRequest{reason: reason, done: make(chan struct{})}
+	w.recycling = req
+	w.recycleChan <- req
+	return req.done
+}
+
+func (w *workerImpl) finishRecycle() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.recycling != nil {
+		close(w.recycling.done)
+		w.recycling = nil
+	}
+}
+
+// stopRecycling releases the pending recycling once the worker has stopped for good,
+// as nothing will process it anymore.
+func (w *workerImpl) stopRecycling() {
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	w.finishRecycle()
+}
+
+// RecordRequest counts a proxied request and schedules recycling when the limit is reached.
+func (w *workerImpl) RecordRequest() {
+	if w.maxRequests <= 0 {
+		return
+	}
+
+	if w.requests.Add(1) == w.requestLimit.Load() {
+		w.log.Info("Worker reached max requests", slog.Int64("requests", w.requestLimit.Load()))
+		w.Recycle(RestartReasonMaxRequests)
 	}
-	return nil
 }
 
-func (w *workerImpl) start() error {
+func (w *workerImpl) recycle(ctx context.Context, reason string) {
+	w.log.Info("Recycling worker", slog.String("reason", reason))
+	if err := w.shutdown(ctx, "recycle: "+reason); err != nil {
+		w.log.Error("Failed to stop worker for recycling", slog.Any("error", err))
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	restartsTotal.WithLabelValues(w.Name, reason).Inc()
+	if err := w.startProcess(ctx, "recycle: "+reason); err != nil {
+		w.log.Error("Failed to restart worker", slog.String("reason", reason), slog.Any("error", err))
+		w.scheduleRestart(ctx, RestartReasonStartFailed)
+	}
+}
+
+// checkRSS samples the resident memory of the worker and recycles it when it
+// stays above the limit for the sustain period.
+func (w *workerImpl) checkRSS() {
+	pid := w.pid()
+	if pid == 0 {
+		return
+	}
+
+	rss, err := readRSS(pid, w.rss.includeChildren)
+	if err != nil {
+		w.log.Debug("Failed to sample worker memory", slog.Int("pid", pid), slog.Any("error", err))
+		return
+	}
+	residentMemory.WithLabelValues(w.Name).Set(float64(rss))
+
+	if w.rss.limit <= 0 || rss < w.rss.limit {
+		w.rssExceeded = time.Time{}
+		return
+	}
+
+	if w.rssExceeded.IsZero() {
+		w.rssExceeded = time.Now()
+		w.log.Warn("Worker exceeded max RSS", slog.Int64("rss", rss), slog.Int64("max_rss", w.rss.limit))
+	}
+
+	if time.Since(w.rssExceeded) >= w.rss.sustain {
+		w.log.Info("Worker stayed above max RSS", slog.Int64("rss", rss), slog.Duration("duration", time.Since(w.rssExceeded)))
+		w.rssExceeded = time.Time{}
+		w.Recycle(RestartReasonMaxRSS)
+	}
+}
+
+func (w *workerImpl) pid() int {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if w.running {
-		w.log.Error("Worker is already running")
+	if !w.status.State.hasProcess() || w.cmd == nil {
+		return 0
+	}
+	return w.cmd.Pid()
+}
+
+// drain takes the worker out of rotation and waits for in-flight requests to finish.
+func (w *workerImpl) drain(ctx context.Context, reason string) {
+	w.mu.Lock()
+	w.setState(StateDraining, reason)
+	w.mu.Unlock()
+
+	w.log.Info("Draining worker", slog.Duration("timeout", w.drainTimeout))
+	drainCtx, cancel := context.WithTimeout(ctx, w.drainTimeout)
+	defer cancel()
+
+	if err := w.connPool.waitIdle(drainCtx); err != nil {
+		w.log.Warn("Worker was not drained in time", slog.Int("in_flight", w.connPool.stats().InUse), slog.Any("error", err))
+		return
+	}
+	w.log.Info("Worker drained")
+}
+
+func (w *workerImpl) start(ctx context.Context, reason string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.startProcess(ctx, reason)
+}
+
+// startProcess spawns the worker process. A process that fails to spawn leaves the
+// worker exited. The caller must hold w.mu.
+func (w *workerImpl) startProcess(ctx context.Context, reason string) error {
+	if w.status.State.hasProcess() {
+		w.log.Error("Worker is already running", slog.String("state", w.status.State.String()))
 		return nil
 	}
 
-	if w.stopping {
+	if ctx.Err() != nil {
 		w.log.Warn("Worker is stopping, will not start again")
 		return nil
 	}
 
-	w.log.Info("Starting worker")
+	w.setState(StateStarting, reason)
 
 	w.connPool.close()
 
-	w.buildCmd()
+	if err := w.removeStaleSockets(); err != nil {
+		w.setState(StateExited, "failed to remove sockets")
+		return fmt.Errorf("failed to remove sockets of worker %s: %w", w, err)
+	}
+
+	if err := w.buildCmd(); err != nil {
+		w.setState(StateExited, "failed to build command")
+		return fmt.Errorf("failed to build command for worker %s: %w", w, err)
+	}
+
+	if w.notifySock != "" {
+		conn, err := listenNotify(w.notifySock)
+		if err != nil {
+			w.setState(StateExited, "failed to listen on notify socket")
+			return fmt.Errorf("failed to listen on notify socket of worker %s: %w", w, err)
+		}
+		w.notifyConn = conn
+	}
+
+	w.oomKills, w.oomKnown = readOOMKills()
 	if err := w.cmd.Start(); err != nil {
+		w.closeNotify()
+		w.setState(StateExited, "failed to start process")
 		return fmt.Errorf("failed to start worker %s: %w", w, err)
 	}
 
-	w.running = true
+	if !w.status.StartedAt.IsZero() {
+		w.status.Restarts++
+	}
+	w.status.StartedAt = time.Now()
+	w.stableTimer = time.AfterFunc(w.restart.cfg.StableUptime, w.markStable)
+	if w.bootTimeout > 0 {
+		cmd := w.cmd
+		w.bootTimer = time.AfterFunc(w.bootTimeout, func() { w.checkBoot(cmd) })
+	}
+	w.killReason = ""
+	w.notifyStopping = false
+	w.timeouts = 0
+	w.status.Message, w.status.Watchdog = "", time.Time{}
+	w.resetRequests()
+	if w.notifyConn != nil {
+		go w.serveNotify(w.cmd, w.notifyConn)
+	}
 
-	go w.waitCmdDone()
+	done := make(chan error, 1)
+	w.cmdDoneChan = done
+	go w.waitCmdDone(ctx, w.cmd, done)
 
-	w.log.Info("Worker started")
+	w.setState(StateBooting, "process started")
 	return nil
 }
 
+// checkBoot kills the process of a worker that is still booting after the boot timeout.
+// The worker is then restarted like after any other unexpected exit.
+func (w *workerImpl) checkBoot(cmd Command) {
+	w.mu.Lock()
+	if w.cmd != cmd || w.status.State != StateBooting {
+		w.mu.Unlock()
+		return
+	}
+	w.killReason = RestartReasonBootTimeout
+	w.mu.Unlock()
+
+	w.log.Error("Worker did not become ready in time, killing it", slog.Duration("boot_timeout", w.bootTimeout))
+	if err := cmd.Kill(); err != nil {
+		w.log.Error("Failed to kill worker", slog.Any("error", err))
+	}
+}
+
+// setState moves the worker to a new state and publishes the transition. The caller must hold w.mu.
+func (w *workerImpl) setState(state State, reason string) {
+	from := w.status.State
+	w.status.State = state
+	w.status.Since = time.Now()
+	w.status.Reason = reason
+	w.events.Publish(Event{Worker: w, From: from, Status: w.status})
+}
+
+// SetSpare moves the worker between the spares kept out of rotation and the active
+// workers. The change is published as an event without a state transition.
+func (w *workerImpl) SetSpare(spare bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.status.Spare == spare {
+		return
+	}
+	w.status.Spare = spare
+	w.events.Publish(Event{Worker: w, From: w.status.State, Status: w.status})
+}
+
+// Status returns a snapshot of the worker lifecycle.
+func (w *workerImpl) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// ReportHealth moves a running worker between the ready and unhealthy states
+// according to the result of a health check.
+func (w *workerImpl) ReportHealth(healthy bool, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timeouts = 0
+	w.reportHealth(healthy, reason)
+}
+
+// reportHealth is ReportHealth for callers that hold w.mu.
+func (w *workerImpl) reportHealth(healthy bool, reason string) {
+	switch state := w.status.State; {
+	case healthy && (state == StateBooting || state == StateUnhealthy):
+		w.setState(StateReady, reason)
+	case !healthy && state == StateReady:
+		w.setState(StateUnhealthy, reason)
+	}
+}
+
+// IsRunning reports whether the worker process is running and not being drained.
 func (w *workerImpl) IsRunning() bool {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.running
+	return w.status.State.IsRunning()
 }
 
-func (w *workerImpl) FetchClientConn(ctx context.Context) (PulledClientConn, error) {
-	w.log.Debug("Waiting for available connection")
-	// TODO: add ability to configure timeout
-	fetchCtx, fetchCancel := context.WithTimeout(ctx, 5*time.Second)
-	defer fetchCancel()
+func (w *workerImpl) IsCrashLooping() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status.CrashLooping
+}
 
-	conn, err := w.connPool.fetchConn(fetchCtx)
+// FetchClientConn pulls a free connection of the pool without waiting for one.
+// The load balancer only dispatches requests to workers with a free connection.
+func (w *workerImpl) FetchClientConn() (PulledClientConn, error) {
+	conn, err := w.connPool.fetchConn()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch gRPC client connection: %v", err)
 	}
 	return conn, nil
 }
 
-func (w *workerImpl) shutdown() error {
+// HealthCheckConn returns a connection to the worker reserved for health checks,
+// which does not take a connection of the pool away from requests.
+func (w *workerImpl) HealthCheckConn() (*grpc.ClientConn, error) {
+	return w.connPool.healthConn()
+}
+
+// PoolStats reports how busy the connection pool of the worker is.
+func (w *workerImpl) PoolStats() PoolStats {
+	return w.connPool.stats()
+}
+
+// shutdown drains the worker and stops its process. The drain is not cut short
+// by the cancellation of ctx, so that stopping the relay lets in-flight requests finish.
+func (w *workerImpl) shutdown(ctx context.Context, reason string) error {
+	w.log.Info("Stopping worker", slog.String("reason", reason))
+
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	running := w.status.State.IsRunning()
+	w.mu.Unlock()
 
-	w.log.Info("Stopping worker")
-	w.stopping = true
+	if running {
+		w.drain(context.WithoutCancel(ctx), reason)
+	}
 
 	w.connPool.close()
 
-	if !w.running {
+	w.mu.Lock()
+	// The restart the worker waits for in backoff is dropped, as the caller either
+	// starts the worker right away or stops it for good.
+	w.cancelRestart()
+	if w.status.State != StateDraining {
+		if state := w.status.State; state != StateNew && state != StateExited {
+			w.setState(StateExited, reason)
+		}
+		w.mu.Unlock()
 		w.log.Warn("Worker is not running, no need to shutdown")
 		return nil
 	}
-	w.running = false
 
 	// Check if the process is still alive
 	if state := w.cmd.ProcessState(); state != nil && state.Exited() {
+		w.setState(StateExited, reason)
+		w.mu.Unlock()
 		w.log.Warn("Worker is already exited")
 		return nil
 	}
 
-	// Send SIGTERM
-	w.log.Debug("Sending SIGTERM to worker")
-	if err := w.cmd.Stop(); err != nil {
-		w.log.Error("Failed to send SIGTERM to worker", slog.Any("error", err))
-		if err := w.cmd.Kill(); err != nil {
+	w.setState(StateStopping, reason)
+	cmd, done := w.cmd, w.cmdDoneChan
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		w.setState(StateExited, reason)
+		w.mu.Unlock()
+	}()
+
+	w.log.Info("Sending stop signal to worker", slog.String("signal", w.stopSignal.String()), slog.Duration("timeout", w.stopTimeout))
+	if err := cmd.Stop(w.stopSignal); err != nil {
+		w.log.Error("Failed to send stop signal to worker", slog.Any("error", err))
+		if err := cmd.Kill(); err != nil {
 			return fmt.Errorf("failed to kill worker %s: %w", w, err)
 		}
 	}
 
 	select {
-	case <-w.cmdDoneChan:
+	case <-done:
 		w.log.Info("Worker stopped")
-	case <-time.After(5 * time.Second):
+	case <-time.After(w.stopTimeout):
 		w.log.Error("Timeout waiting for worker to exit, sending SIGKILL")
-		if err := w.cmd.Kill(); err != nil {
+		if err := cmd.Kill(); err != nil {
 			return fmt.Errorf("failed to kill worker %s: %w", w, err)
 		}
+		<-done
 	}
 
 	return nil
 }
 
-func (w *workerImpl) waitCmdDone() {
-	err := w.cmd.Wait()
-	if err != nil {
-		w.log.Error("Worker exited unexpectedly", slog.Any("error", err))
-	} else {
-		w.log.Info("Worker exited normally")
+func (w *workerImpl) waitCmdDone(ctx context.Context, cmd Command, done chan<- error) {
+	err := cmd.Wait()
+
+	w.mu.Lock()
+	for _, output := range w.outputs {
+		output.flush()
+	}
+	for _, tw := range w.tailWriters {
+		tw.flush()
 	}
+	w.status.ExitCode, w.status.ExitSignal = exitStatus(err)
+	w.stableTimer.Stop()
+	if w.bootTimer != nil {
+		w.bootTimer.Stop()
+	}
+	w.closeNotify()
 
-	if w.stopping {
-		w.log.Debug("Closing cmdDoneChan")
-		w.cmdDoneChan <- err
-		close(w.cmdDoneChan)
-		w.log.Debug("cmdDoneChan closed")
+	// The process is being stopped, shutdown takes care of the state.
+	if state := w.status.State; state == StateDraining || state == StateStopping {
+		w.mu.Unlock()
+		done <- err
+		close(done)
 		return
 	}
+	close(done)
 
-	w.log.Debug("Setting worker as not running")
-	w.mu.Lock()
-	w.running = false
+	restartReason, exitReason := RestartReasonExit, "process exited"
+	switch {
+	case w.killReason != "":
+		restartReason, exitReason = w.killReason, w.killReason
+	case err != nil:
+		exitReason = err.Error()
+	}
+	w.setState(StateExited, exitReason)
+	w.reportCrash(cmd)
+	w.scheduleRestart(ctx, restartReason)
 	w.mu.Unlock()
+}
 
-	time.Sleep(1 * time.Second)
+// scheduleRestart restarts the exited worker after the restart backoff, counting the
+// restart for crash loop detection. The caller must hold w.mu.
+func (w *workerImpl) scheduleRestart(ctx context.Context, reason string) {
+	delay := w.restart.nextDelay()
+	if w.restart.recordRestart(time.Now()) && !w.status.CrashLooping {
+		w.status.CrashLooping = true
+		crashLooping.WithLabelValues(w.Name).Set(1)
+		w.log.Error("Worker is crash looping",
+			slog.Int("restarts", w.restart.cfg.CrashLoopRestarts),
+			slog.Duration("window", w.restart.cfg.CrashLoopWindow))
+	}
+
+	backoffState := StateBackoff
+	if w.status.CrashLooping {
+		backoffState = StateCrashLoop
+	}
+	w.setState(backoffState, fmt.Sprintf("restarting in %s", delay))
+
+	pending := make(chan struct{})
+	w.pendingRestart = pending
+	go w.restartAfter(ctx, delay, reason, pending)
+}
 
-	if err := w.start(); err != nil {
+// cancelRestart cancels the restart the worker is waiting for in backoff, if any.
+// The caller must hold w.mu.
+func (w *workerImpl) cancelRestart() {
+	if w.pendingRestart != nil {
+		close(w.pendingRestart)
+		w.pendingRestart = nil
+	}
+}
+
+// restartAfter starts the worker after delay unless the restart was cancelled in the
+// meantime. A process that fails to spawn is retried like one that crashed.
+func (w *workerImpl) restartAfter(ctx context.Context, delay time.Duration, reason string, pending chan struct{}) {
+	select {
+	case <-time.After(delay):
+	case <-pending:
+		return
+	case <-ctx.Done():
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The restart may have been cancelled while waiting for the lock.
+	if w.pendingRestart != pending {
+		return
+	}
+	w.pendingRestart = nil
+
+	restartsTotal.WithLabelValues(w.Name, reason).Inc()
+	if err := w.startProcess(ctx, "restart after "+reason); err != nil {
 		w.log.Error("Failed to restart worker", slog.Any("error", err))
+		w.scheduleRestart(ctx, RestartReasonStartFailed)
 	}
 }
 
-func (w *workerImpl) buildCmd() {
-	args := w.cmdArgs()
-	w.cmd = w.cmdExecutor.NewCommand(args[0], args[1:]...)
+// reportCrash logs, counts and keeps a report on the unexpected exit of the process
+// started by cmd. The caller must hold w.mu.
+func (w *workerImpl) reportCrash(cmd Command) {
+	var oomKills int64
+	count, ok := readOOMKills()
+	oomKnown := ok && w.oomKnown
+	if oomKnown {
+		oomKills = max(count-w.oomKills, 0)
+	}
+
+	report := CrashReport{
+		Worker:    w.Name,
+		PID:       cmd.Pid(),
+		ExitCode:  w.status.ExitCode,
+		Signal:    w.status.ExitSignal,
+		KilledBy:  w.killReason,
+		OOMKills:  oomKills,
+		StartedAt: w.status.StartedAt,
+		ExitedAt:  time.Now(),
+		Restarts:  w.status.Restarts,
+	}
+	report.Reason = classifyExit(report.ExitCode, report.Signal, report.KilledBy, report.OOMKills, oomKnown)
+	if w.tail != nil {
+		report.Output = w.tail.snapshot()
+	}
+
+	crashesTotal.WithLabelValues(w.Name, string(report.Reason)).Inc()
+	logCrash := w.log.Error
+	if report.Reason == ExitReasonClean {
+		logCrash = w.log.Warn
+	}
+	logCrash("Worker crashed",
+		slog.String("reason", string(report.Reason)),
+		slog.Int("pid", report.PID),
+		slog.Int("exit_code", report.ExitCode),
+		slog.String("signal", report.Signal),
+		slog.String("killed_by", report.KilledBy),
+		slog.Int64("oom_kills", report.OOMKills),
+		slog.Duration("uptime", report.ExitedAt.Sub(report.StartedAt)),
+		slog.Any("output", report.Output))
+
+	if w.keepCrashes > 0 {
+		w.crashes = append(w.crashes, report)
+		if len(w.crashes) > w.keepCrashes {
+			w.crashes = slices.Delete(w.crashes, 0, len(w.crashes)-w.keepCrashes)
+		}
+	}
+}
+
+// CrashReports returns the last reports on unexpected exits of the worker, oldest first.
+func (w *workerImpl) CrashReports() []CrashReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.crashes)
+}
+
+// markStable resets the restart backoff once the worker has been up for the stable uptime.
+func (w *workerImpl) markStable() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	cmdEnv := os.Environ()
-	cmdEnv = append(cmdEnv, fmt.Sprintf("PROMETHEUS_EXPORTER_PORT=%d", w.metricsPort))
-	cmdEnv = append(cmdEnv, fmt.Sprintf("PROMETHEUS_EXPORTER_PATH=%s", w.metricsPath))
-	cmdEnv = append(cmdEnv, fmt.Sprintf("RAILS_MAX_THREADS=%d", w.poolSize))
+	if !w.status.State.IsRunning() || time.Since(w.status.StartedAt) < w.restart.cfg.StableUptime {
+		return
+	}
+
+	w.restart.reset()
+	if w.status.CrashLooping {
+		w.status.CrashLooping = false
+		crashLooping.WithLabelValues(w.Name).Set(0)
+		w.log.Info("Worker is stable, leaving crash loop")
+		// A ready worker goes back into rotation.
+		w.events.Publish(Event{Worker: w, From: w.status.State, Status: w.status})
+	}
+}
+
+func (w *workerImpl) resetRequests() {
+	limit := w.maxRequests
+	if w.maxJitter > 0 {
+		limit += rand.IntN(w.maxJitter + 1)
+	}
+	w.requests.Store(0)
+	w.requestLimit.Store(int64(limit))
+}
+
+// removeStaleSockets removes sockets left by a previous process, so that the new one can bind them.
+func (w *workerImpl) removeStaleSockets() error {
+	for _, path := range []string{w.socket, w.metricsSock, w.notifySock} {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *workerImpl) buildCmd() error {
+	vars := w.templateVars()
+
+	if len(w.command) == 0 {
+		return fmt.Errorf("command is empty")
+	}
+
+	args := make([]string, 0, len(w.command))
+	for _, arg := range w.command {
+		rendered, err := config.RenderTemplate(arg, vars)
+		if err != nil {
+			return err
+		}
+		args = append(args, rendered)
+	}
+
+	// The notify socket of the relay itself is not passed on, so that a worker
+	// only ever notifies its own socket.
+	cmdEnv := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, NotifySocketEnv+"=")
+	})
+	for _, name := range slices.Sorted(maps.Keys(w.env)) {
+		value, err := config.RenderTemplate(w.env[name], vars)
+		if err != nil {
+			return err
+		}
+		cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%s", name, value))
+	}
+	if w.notifySock != "" {
+		cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%s", NotifySocketEnv, w.notifySock))
+	}
+
+	w.cmd = w.cmdExecutor.NewCommand(args[0], args[1:]...)
 	w.cmd.SetEnv(cmdEnv)
+	if w.dir != "" {
+		w.cmd.SetDir(w.dir)
+	}
+	w.setOutput()
 	w.log.Debug("Command built", "command", args)
+	return nil
 }
 
-func (w *workerImpl) cmdArgs() []string {
-	return []string{"bundle", "exec", "gruf", "--host", w.Addr(), "--health-check", "--backtrace-on-error"}
+// setOutput directs the output of the command to the logger or the output of the relay,
+// capturing stderr for thread dumps when the hang watchdog is enabled.
+func (w *workerImpl) setOutput() {
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	w.outputs = nil
+	if w.maxLineLength > 0 {
+		stdoutLog := newOutputLogger(w.log, "stdout", w.maxLineLength)
+		stderrLog := newOutputLogger(w.log, "stderr", w.maxLineLength)
+		w.outputs = []*outputLogger{stdoutLog, stderrLog}
+		stdout, stderr = stdoutLog, stderrLog
+	}
+
+	w.tailWriters = nil
+	if w.tail != nil {
+		w.tail.reset()
+		stdoutTail, stderrTail := w.tail.writer("stdout"), w.tail.writer("stderr")
+		w.tailWriters = []*tailWriter{stdoutTail, stderrTail}
+		stdout, stderr = io.MultiWriter(stdout, stdoutTail), io.MultiWriter(stderr, stderrTail)
+	}
+
+	if w.hang.timeouts > 0 {
+		w.stderr = &outputCapture{out: stderr}
+		stderr = w.stderr
+	}
+
+	if stdout != os.Stdout {
+		w.cmd.SetStdout(stdout)
+	}
+	if stderr != os.Stderr {
+		w.cmd.SetStderr(stderr)
+	}
+}
+
+func (w *workerImpl) templateVars() config.WorkerVars {
+	return config.WorkerVars{
+		Name:          w.Name,
+		Index:         w.index,
+		Addr:          w.Addr(),
+		Port:          w.port,
+		MetricsPort:   w.metricsPort,
+		MetricsPath:   w.metricsPath,
+		Socket:        w.socket,
+		MetricsSocket: w.metricsSock,
+		NotifySocket:  w.notifySock,
+		PoolSize:      w.poolSize,
+		Dir:           w.dir,
+	}
 }
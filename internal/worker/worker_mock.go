@@ -14,6 +14,7 @@ import (
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
+	grpc "google.golang.org/grpc"
 )
 
 // MockWorker is a mock of Worker interface.
@@ -54,19 +55,62 @@ func (mr *MockWorkerMockRecorder) Addr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Addr", reflect.TypeOf((*MockWorker)(nil).Addr))
 }
 
+// CrashReports mocks base method.
+func (m *MockWorker) CrashReports() []CrashReport {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CrashReports")
+	ret0, _ := ret[0].([]CrashReport)
+	return ret0
+}
+
+// CrashReports indicates an expected call of CrashReports.
+func (mr *MockWorkerMockRecorder) CrashReports() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CrashReports", reflect.TypeOf((*MockWorker)(nil).CrashReports))
+}
+
 // FetchClientConn mocks base method.
-func (m *MockWorker) FetchClientConn(ctx context.Context) (PulledClientConn, error) {
+func (m *MockWorker) FetchClientConn() (PulledClientConn, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FetchClientConn", ctx)
+	ret := m.ctrl.Call(m, "FetchClientConn")
 	ret0, _ := ret[0].(PulledClientConn)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FetchClientConn indicates an expected call of FetchClientConn.
-func (mr *MockWorkerMockRecorder) FetchClientConn(ctx any) *gomock.Call {
+func (mr *MockWorkerMockRecorder) FetchClientConn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchClientConn", reflect.TypeOf((*MockWorker)(nil).FetchClientConn))
+}
+
+// HealthCheckConn mocks base method.
+func (m *MockWorker) HealthCheckConn() (*grpc.ClientConn, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HealthCheckConn")
+	ret0, _ := ret[0].(*grpc.ClientConn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HealthCheckConn indicates an expected call of HealthCheckConn.
+func (mr *MockWorkerMockRecorder) HealthCheckConn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HealthCheckConn", reflect.TypeOf((*MockWorker)(nil).HealthCheckConn))
+}
+
+// IsCrashLooping mocks base method.
+func (m *MockWorker) IsCrashLooping() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsCrashLooping")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsCrashLooping indicates an expected call of IsCrashLooping.
+func (mr *MockWorkerMockRecorder) IsCrashLooping() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchClientConn", reflect.TypeOf((*MockWorker)(nil).FetchClientConn), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsCrashLooping", reflect.TypeOf((*MockWorker)(nil).IsCrashLooping))
 }
 
 // IsRunning mocks base method.
@@ -97,6 +141,98 @@ func (mr *MockWorkerMockRecorder) MetricsAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MetricsAddr", reflect.TypeOf((*MockWorker)(nil).MetricsAddr))
 }
 
+// MetricsSocket mocks base method.
+func (m *MockWorker) MetricsSocket() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MetricsSocket")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// MetricsSocket indicates an expected call of MetricsSocket.
+func (mr *MockWorkerMockRecorder) MetricsSocket() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MetricsSocket", reflect.TypeOf((*MockWorker)(nil).MetricsSocket))
+}
+
+// NotifySocket mocks base method.
+func (m *MockWorker) NotifySocket() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NotifySocket")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// NotifySocket indicates an expected call of NotifySocket.
+func (mr *MockWorkerMockRecorder) NotifySocket() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotifySocket", reflect.TypeOf((*MockWorker)(nil).NotifySocket))
+}
+
+// PoolStats mocks base method.
+func (m *MockWorker) PoolStats() PoolStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PoolStats")
+	ret0, _ := ret[0].(PoolStats)
+	return ret0
+}
+
+// PoolStats indicates an expected call of PoolStats.
+func (mr *MockWorkerMockRecorder) PoolStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PoolStats", reflect.TypeOf((*MockWorker)(nil).PoolStats))
+}
+
+// RecordRequest mocks base method.
+func (m *MockWorker) RecordRequest() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RecordRequest")
+}
+
+// RecordRequest indicates an expected call of RecordRequest.
+func (mr *MockWorkerMockRecorder) RecordRequest() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordRequest", reflect.TypeOf((*MockWorker)(nil).RecordRequest))
+}
+
+// Recycle mocks base method.
+func (m *MockWorker) Recycle(reason string) <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Recycle", reason)
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Recycle indicates an expected call of Recycle.
+func (mr *MockWorkerMockRecorder) Recycle(reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Recycle", reflect.TypeOf((*MockWorker)(nil).Recycle), reason)
+}
+
+// ReportHealth mocks base method.
+func (m *MockWorker) ReportHealth(healthy bool, reason string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReportHealth", healthy, reason)
+}
+
+// ReportHealth indicates an expected call of ReportHealth.
+func (mr *MockWorkerMockRecorder) ReportHealth(healthy, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportHealth", reflect.TypeOf((*MockWorker)(nil).ReportHealth), healthy, reason)
+}
+
+// ReportTimeout mocks base method.
+func (m *MockWorker) ReportTimeout() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReportTimeout")
+}
+
+// ReportTimeout indicates an expected call of ReportTimeout.
+func (mr *MockWorkerMockRecorder) ReportTimeout() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportTimeout", reflect.TypeOf((*MockWorker)(nil).ReportTimeout))
+}
+
 // Run mocks base method.
 func (m *MockWorker) Run(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -111,6 +247,32 @@ func (mr *MockWorkerMockRecorder) Run(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockWorker)(nil).Run), arg0)
 }
 
+// SetSpare mocks base method.
+func (m *MockWorker) SetSpare(spare bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetSpare", spare)
+}
+
+// SetSpare indicates an expected call of SetSpare.
+func (mr *MockWorkerMockRecorder) SetSpare(spare any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSpare", reflect.TypeOf((*MockWorker)(nil).SetSpare), spare)
+}
+
+// Status mocks base method.
+func (m *MockWorker) Status() Status {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Status")
+	ret0, _ := ret[0].(Status)
+	return ret0
+}
+
+// Status indicates an expected call of Status.
+func (mr *MockWorkerMockRecorder) Status() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockWorker)(nil).Status))
+}
+
 // String mocks base method.
 func (m *MockWorker) String() string {
 	m.ctrl.T.Helper()
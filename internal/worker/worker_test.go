@@ -1,15 +1,32 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/bibendi/gruf-relay/internal/config"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -40,6 +57,77 @@ var _ = Describe("Worker", func() {
 		})
 	})
 
+	Describe("WithUnixSocket", func() {
+		It("listens on unix sockets instead of ports", func() {
+			dir := GinkgoT().TempDir()
+			w := NewWorker("worker-1", 0, 0, "/metrics", 2, WithUnixSocket(dir))
+			Expect(w.Addr()).To(Equal("unix:" + filepath.Join(dir, "worker-1.sock")))
+			Expect(w.MetricsSocket()).To(Equal(filepath.Join(dir, "worker-1-metrics.sock")))
+			Expect(w.MetricsAddr()).To(Equal("localhost/metrics"))
+		})
+
+		It("removes stale sockets before starting", func() {
+			dir := GinkgoT().TempDir()
+			w := NewWorker("worker-1", 0, 0, "/metrics", 2, WithUnixSocket(dir))
+			Expect(os.WriteFile(w.socket, nil, 0o600)).To(Succeed())
+
+			Expect(w.removeStaleSockets()).To(Succeed())
+			Expect(w.socket).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Describe("buildCmd", func() {
+		It("renders command and env templates", func() {
+			mockExecutor := NewMockCommandExecutor(ctrl)
+			mockCommand := NewMockCommand(ctrl)
+			w := NewWorker("worker-2", 50052, 9092, "/metrics", 3,
+				WithExecutor(mockExecutor),
+				WithIndex(1),
+				WithNotifySocket("/run/gruf-relay", 0),
+				WithDir("/app/releases/1"),
+				WithCommand(
+					[]string{"bin/gruf", "--host", "{{.Addr}}", "--name={{.Name}}-{{.Index}}"},
+					map[string]string{"PROMETHEUS_EXPORTER_PORT": "{{.MetricsPort}}", "RAILS_MAX_THREADS": "{{.PoolSize}}", "BUNDLE_GEMFILE": "{{.Dir}}/Gemfile"},
+				),
+			)
+
+			mockExecutor.EXPECT().NewCommand("bin/gruf", "--host", "0.0.0.0:50052", "--name=worker-2-1").Return(mockCommand)
+			mockCommand.EXPECT().SetEnv(gomock.Any()).Do(func(env []string) {
+				Expect(env).To(ContainElements(
+					"PROMETHEUS_EXPORTER_PORT=9092",
+					"RAILS_MAX_THREADS=3",
+					"NOTIFY_SOCKET=/run/gruf-relay/worker-2-notify.sock",
+					"BUNDLE_GEMFILE=/app/releases/1/Gemfile",
+				))
+			})
+			mockCommand.EXPECT().SetDir("/app/releases/1")
+
+			Expect(w.buildCmd()).To(Succeed())
+		})
+
+		It("does not pass the notify socket of the relay on", func() {
+			GinkgoT().Setenv(NotifySocketEnv, "/run/systemd/notify")
+			mockExecutor := NewMockCommandExecutor(ctrl)
+			mockCommand := NewMockCommand(ctrl)
+			w := NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bin/gruf"}, nil),
+			)
+
+			mockExecutor.EXPECT().NewCommand("bin/gruf").Return(mockCommand)
+			mockCommand.EXPECT().SetEnv(gomock.Any()).Do(func(env []string) {
+				Expect(env).NotTo(ContainElement(HavePrefix("NOTIFY_SOCKET=")))
+			})
+
+			Expect(w.buildCmd()).To(Succeed())
+		})
+
+		It("returns an error when the command is empty", func() {
+			w := NewWorker("worker-1", 50051, 9090, "/metrics", 2)
+			Expect(w.buildCmd()).To(HaveOccurred())
+		})
+	})
+
 	Describe("Run", func() {
 		var (
 			worker       *workerImpl
@@ -58,7 +146,8 @@ var _ = Describe("Worker", func() {
 			mockExecutor.EXPECT().NewCommand(gomock.Any(), gomock.Any()).Return(mockCommand).AnyTimes()
 			mockCommand.EXPECT().SetEnv(gomock.Any()).AnyTimes()
 
-			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2, withExecutor)
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2, withExecutor,
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil))
 
 			DeferCleanup(func() {
 				cancel()
@@ -72,45 +161,1082 @@ var _ = Describe("Worker", func() {
 				<-wCtx.Done()
 				return nil
 			})
-			mockCommand.EXPECT().Stop().DoAndReturn(func() error {
+			mockCommand.EXPECT().Stop(syscall.SIGTERM).DoAndReturn(func(syscall.Signal) error {
 				wCancel()
 				return nil
 			})
 			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
 
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(worker.IsRunning).Should(BeTrue())
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(worker.IsRunning()).To(BeFalse())
+		})
+
+		It("should send the stop signal and kill the worker after the shutdown timeout", func() {
+			events := NewEventBus()
+			states := recordStates(events)
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithEvents(events),
+				WithShutdown(time.Second, 50*time.Millisecond, syscall.SIGQUIT))
+
+			killed := make(chan struct{})
+			mockCommand.EXPECT().Start().Return(nil)
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-killed
+				return errors.New("signal: killed")
+			})
+			mockCommand.EXPECT().Stop(syscall.SIGQUIT).Return(nil)
+			mockCommand.EXPECT().Kill().DoAndReturn(func() error {
+				close(killed)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(worker.IsRunning).Should(BeTrue())
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(killed).To(BeClosed())
+			Expect(states()).To(Equal([]State{StateStarting, StateBooting, StateDraining, StateStopping, StateExited}))
+			Expect(worker.Status().Reason).To(Equal("relay shutdown"))
+		})
+
+		It("should kill and restart a worker that does not boot in time", func() {
+			events := NewEventBus()
+			states := recordStates(events)
+			worker = NewWorker("worker-boot", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithEvents(events),
+				WithRestartPolicy(config.Restart{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 1, StableUptime: time.Minute}),
+				WithBootTimeout(50*time.Millisecond))
+
+			killed := make(chan struct{})
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				if starts == 2 {
+					close(restarted)
+				}
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-killed
+				return errors.New("signal: killed")
+			})
+			mockCommand.EXPECT().Kill().DoAndReturn(func() error {
+				close(killed)
+				return nil
+			})
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(restarted).Should(BeClosed())
+			// The restarted worker becomes ready in time.
+			worker.ReportHealth(true, "SERVING")
+			Expect(worker.Status().State).To(Equal(StateReady))
+			Expect(testutil.ToFloat64(restartsTotal.WithLabelValues("worker-boot", RestartReasonBootTimeout))).To(Equal(1.0))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(states()).To(HaveExactElements(
+				StateStarting, StateBooting, StateExited, StateBackoff, StateStarting, StateBooting, StateReady,
+				StateDraining, StateStopping, StateExited,
+			))
+		})
+
+		It("should follow the notifications of the worker process", func() {
+			events := NewEventBus()
+			states := recordStates(events)
+			dir := GinkgoT().TempDir()
+			worker = NewWorker("worker-notify", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithEvents(events),
+				WithNotifySocket(dir, 50*time.Millisecond))
+			Expect(worker.NotifySocket()).To(Equal(filepath.Join(dir, "worker-notify-notify.sock")))
+
+			exited := make(chan struct{})
+			mockCommand.EXPECT().Start().Return(nil)
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-exited
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(exited)
+				return nil
+			})
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+			Eventually(worker.IsRunning).Should(BeTrue())
+
+			conn, err := net.Dial("unixgram", worker.NotifySocket())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			notify := func(msg string) {
+				_, err := conn.Write([]byte(msg))
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			notify("READY=1\nSTATUS=Serving 2 threads")
+			Eventually(func() Status { return worker.Status() }).Should(And(
+				HaveField("State", StateReady),
+				HaveField("Message", "Serving 2 threads"),
+			))
+
+			// The worker is reported unhealthy when it stops pinging the watchdog.
+			notify("WATCHDOG=1")
+			Eventually(func() string { return worker.Status().Reason }).Should(Equal(notifyReasonWatchdog))
+			Expect(worker.Status().State).To(Equal(StateUnhealthy))
+			notify("WATCHDOG=1")
+			Eventually(func() State { return worker.Status().State }).Should(Equal(StateReady))
+
+			// A stopping worker does not become ready again.
+			notify("STOPPING=1")
+			Eventually(func() State { return worker.Status().State }).Should(Equal(StateUnhealthy))
+			notify("READY=1")
+			Consistently(func() State { return worker.Status().State }, 100*time.Millisecond).Should(Equal(StateUnhealthy))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(states()).To(HaveExactElements(
+				StateStarting, StateBooting, StateReady, StateUnhealthy, StateReady, StateUnhealthy,
+				StateDraining, StateStopping, StateExited,
+			))
+		})
+
+		It("should capture a dump and restart a hung worker", func() {
+			events := NewEventBus()
+			states := recordStates(events)
+			worker = NewWorker("worker-hung", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithEvents(events),
+				WithRestartPolicy(config.Restart{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 1, StableUptime: time.Minute}),
+				WithHangWatchdog(2, syscall.SIGQUIT, 20*time.Millisecond))
+
+			var stderr io.Writer
+			mockCommand.EXPECT().SetStderr(gomock.Any()).Do(func(w io.Writer) { stderr = w }).Times(2)
+			killed := make(chan struct{})
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				if starts == 2 {
+					close(restarted)
+				}
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-killed
+				return errors.New("signal: killed")
+			})
+			mockCommand.EXPECT().Stop(syscall.SIGQUIT).DoAndReturn(func(syscall.Signal) error {
+				_, err := stderr.Write([]byte("Thread dump\n"))
+				return err
+			})
+			mockCommand.EXPECT().Kill().DoAndReturn(func() error {
+				Expect(worker.stderr.buf).To(BeNil())
+				close(killed)
+				return nil
+			})
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(syscall.SIGTERM).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+			Eventually(worker.IsRunning).Should(BeTrue())
+
+			worker.ReportHealth(true, "SERVING")
+			worker.ReportTimeout()
+			// A successful check in between starts the count over.
+			worker.ReportHealth(true, "SERVING")
+			worker.ReportTimeout()
+			worker.ReportTimeout()
+
+			Eventually(restarted).Should(BeClosed())
+			Expect(testutil.ToFloat64(restartsTotal.WithLabelValues("worker-hung", RestartReasonHung))).To(Equal(1.0))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(states()).To(HaveExactElements(
+				StateStarting, StateBooting, StateReady, StateUnhealthy, StateReady, StateUnhealthy,
+				StateExited, StateBackoff, StateStarting, StateBooting,
+				StateDraining, StateStopping, StateExited,
+			))
+		})
+
+		It("should enter a crash loop when the worker keeps exiting", func() {
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithRestartPolicy(config.Restart{
+					InitialDelay:      10 * time.Millisecond,
+					MaxDelay:          10 * time.Millisecond,
+					Multiplier:        1,
+					StableUptime:      time.Minute,
+					CrashLoopRestarts: 3,
+					CrashLoopWindow:   time.Minute,
+				}))
+			mockCommand.EXPECT().Start().Return(nil).MinTimes(3)
+			mockCommand.EXPECT().Wait().Return(errors.New("boot failed")).MinTimes(3)
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+			mockCommand.EXPECT().Stop(gomock.Any()).Return(nil).AnyTimes()
+
 			go func() {
-				time.Sleep(100 * time.Millisecond)
+				defer GinkgoRecover()
+				Eventually(worker.IsCrashLooping).Should(BeTrue())
 				cancel()
 			}()
 
 			err := worker.Run(ctx)
 			Expect(err).NotTo(HaveOccurred())
-			Eventually(worker.IsRunning()).Should(BeFalse())
 		})
 
-		It("should restart if the worker exits with an error", func() {
-			firstRun := true
+		It("should back off and retry when the worker process fails to start", func() {
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithRestartPolicy(config.Restart{
+					InitialDelay:      10 * time.Millisecond,
+					MaxDelay:          10 * time.Millisecond,
+					Multiplier:        1,
+					StableUptime:      time.Minute,
+					CrashLoopRestarts: 3,
+					CrashLoopWindow:   time.Minute,
+				}))
+
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				switch starts {
+				case 1:
+					return nil
+				case 4:
+					close(restarted)
+					return nil
+				default:
+					return errors.New("exec: bin/gruf: no such file")
+				}
+			}).Times(4)
+			mockCommand.EXPECT().Wait().Return(errors.New("boot failed"))
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(restarted).Should(BeClosed())
+			Eventually(worker.IsRunning).Should(BeTrue())
+			// The crash and both failed starts count towards the crash loop.
+			Expect(worker.Status()).To(And(HaveField("Restarts", 1), HaveField("CrashLooping", true)))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		It("should drop the backoff restart when a worker in backoff is recycled", func() {
+			worker = NewWorker("worker-recycled-in-backoff", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithRestartPolicy(config.Restart{InitialDelay: 100 * time.Millisecond, MaxDelay: 100 * time.Millisecond, Multiplier: 1, StableUptime: time.Minute}))
+
 			mockCommand.EXPECT().Start().Return(nil).Times(2)
+			mockCommand.EXPECT().Wait().Return(errors.New("boot failed"))
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(func() State { return worker.Status().State }).Should(Equal(StateBackoff))
+			Eventually(worker.Recycle(RestartReasonRollingRestart)).Should(BeClosed())
+			Expect(worker.IsRunning()).To(BeTrue())
+
+			// The restart scheduled by the backoff does not start the worker a second time.
+			Consistently(func() float64 {
+				return testutil.ToFloat64(restartsTotal.WithLabelValues(worker.Name, RestartReasonExit))
+			}, 300*time.Millisecond).Should(BeZero())
+			Expect(worker.Status().Restarts).To(Equal(1))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		It("should let a crash looping worker boot and leave the crash loop once stable", func() {
+			events := NewEventBus()
+			var (
+				mu        sync.Mutex
+				published []Status
+			)
+			events.Subscribe(func(e Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				published = append(published, e.Status)
+			})
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithEvents(events),
+				WithRestartPolicy(config.Restart{
+					InitialDelay:      10 * time.Millisecond,
+					MaxDelay:          10 * time.Millisecond,
+					Multiplier:        1,
+					StableUptime:      200 * time.Millisecond,
+					CrashLoopRestarts: 1,
+					CrashLoopWindow:   time.Minute,
+				}),
+				WithBootTimeout(100*time.Millisecond))
+
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				if starts == 2 {
+					close(restarted)
+				}
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Wait().Return(errors.New("boot failed"))
+			stopped := make(chan struct{})
 			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
-				if firstRun {
-					firstRun = false
-					return errors.New("test error")
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(restarted).Should(BeClosed())
+			// The boot timeout is shorter than the stable uptime, so the worker must pass
+			// a health check while crash looping to stay up.
+			worker.ReportHealth(true, "SERVING")
+			Expect(worker.Status()).To(And(HaveField("State", StateReady), HaveField("CrashLooping", true)))
+
+			Eventually(worker.IsCrashLooping).Should(BeFalse())
+			mu.Lock()
+			Expect(published[len(published)-1]).To(And(HaveField("State", StateReady), HaveField("CrashLooping", false)))
+			mu.Unlock()
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		It("should drain and restart the worker after max requests", func() {
+			events := NewEventBus()
+			states := recordStates(events)
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithEvents(events),
+				WithMaxRequests(2, 0))
+
+			stopped := make(chan struct{}, 2)
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				if starts == 2 {
+					close(restarted)
 				}
-				go func() {
-					<-ctx.Done()
-				}()
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Stop(syscall.SIGTERM).DoAndReturn(func(syscall.Signal) error {
+				stopped <- struct{}{}
 				return nil
 			}).Times(2)
 			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
 
+			errChan := make(chan error, 1)
 			go func() {
-				time.Sleep(1500 * time.Millisecond)
-				cancel()
+				errChan <- worker.Run(ctx)
 			}()
 
-			err := worker.Run(ctx)
+			Eventually(worker.IsRunning).Should(BeTrue())
+			worker.RecordRequest()
+			worker.RecordRequest()
+
+			Eventually(restarted).Should(BeClosed())
+			Eventually(worker.IsRunning).Should(BeTrue())
+			Expect(worker.Status().Restarts).To(Equal(1))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(states()).To(Equal([]State{
+				StateStarting, StateBooting,
+				StateDraining, StateStopping, StateExited, StateStarting, StateBooting,
+				StateDraining, StateStopping, StateExited,
+			}))
+		})
+
+		It("should drain and restart the worker when it exceeds max RSS", func() {
+			originalProcRoot := procRoot
+			procRoot = GinkgoT().TempDir()
+			DeferCleanup(func() { procRoot = originalProcRoot })
+			Expect(os.MkdirAll(filepath.Join(procRoot, "42"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(procRoot, "42", "status"), []byte("Name:\truby\nVmRSS:\t  2048 kB\n"), 0o644)).To(Succeed())
+
+			worker = NewWorker("worker-rss", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithRSSSampling(10*time.Millisecond, false),
+				WithMaxRSS(1024*1024, 0))
+
+			stopped := make(chan struct{}, 2)
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				if starts == 2 {
+					close(restarted)
+				}
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Pid().DoAndReturn(func() int {
+				if starts >= 2 {
+					return 43
+				}
+				return 42
+			}).AnyTimes()
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Stop(syscall.SIGTERM).DoAndReturn(func(syscall.Signal) error {
+				stopped <- struct{}{}
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(restarted).Should(BeClosed())
+			Expect(testutil.ToFloat64(residentMemory.WithLabelValues("worker-rss"))).To(Equal(2048.0 * 1024))
+
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		It("should report crashes with the last output of the worker", func() {
+			originalProcRoot, originalCgroupRoot := procRoot, cgroupRoot
+			procRoot, cgroupRoot = GinkgoT().TempDir(), GinkgoT().TempDir()
+			DeferCleanup(func() { procRoot, cgroupRoot = originalProcRoot, originalCgroupRoot })
+			Expect(os.MkdirAll(filepath.Join(procRoot, "self"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(procRoot, "self", "cgroup"), []byte("0::/relay\n"), 0o644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(cgroupRoot, "relay"), 0o755)).To(Succeed())
+			memoryEvents := filepath.Join(cgroupRoot, "relay", "memory.events")
+			Expect(os.WriteFile(memoryEvents, []byte("oom 0\noom_kill 0\n"), 0o644)).To(Succeed())
+
+			worker = NewWorker("worker-crash", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithRestartPolicy(config.Restart{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 1, StableUptime: time.Minute}),
+				WithCrashReports(2, 1))
+
+			var stdout, stderr io.Writer
+			mockCommand.EXPECT().SetStdout(gomock.Any()).Do(func(w io.Writer) { stdout = w }).AnyTimes()
+			mockCommand.EXPECT().SetStderr(gomock.Any()).Do(func(w io.Writer) { stderr = w }).AnyTimes()
+			mockCommand.EXPECT().Start().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				fmt.Fprintln(stdout, "Booting")
+				fmt.Fprintln(stderr, "Segmentation fault")
+				fmt.Fprint(stdout, "Aborted")
+				return exec.Command("sh", "-c", "exit 3").Run()
+			})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				Expect(os.WriteFile(memoryEvents, []byte("oom 1\noom_kill 1\n"), 0o644)).To(Succeed())
+				return exec.Command("sh", "-c", "kill -KILL $$").Run()
+			})
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(func() float64 {
+				return testutil.ToFloat64(crashesTotal.WithLabelValues("worker-crash", string(ExitReasonCode)))
+			}).Should(Equal(1.0))
+			Eventually(worker.CrashReports).Should(HaveExactElements(And(
+				HaveField("Reason", ExitReasonOOM),
+				HaveField("Signal", syscall.SIGKILL.String()),
+				HaveField("OOMKills", int64(1)),
+				HaveField("Restarts", 1),
+				HaveField("Output", BeEmpty()),
+			)))
+
+			Eventually(worker.IsRunning).Should(BeTrue())
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		It("should not wait for recycling once the worker has stopped", func() {
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Start().Return(nil)
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(worker.IsRunning).Should(BeTrue())
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(worker.Recycle(RestartReasonRollingRestart)).To(BeClosed())
+		})
+
+		It("should restart if the worker exits with an error", func() {
+			worker = NewWorker("worker-1", 50051, 9090, "/metrics", 2,
+				WithExecutor(mockExecutor),
+				WithCommand([]string{"bundle", "exec", "gruf"}, nil),
+				WithRestartPolicy(config.Restart{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 1, StableUptime: time.Minute}))
+
+			restarted := make(chan struct{})
+			starts := 0
+			mockCommand.EXPECT().Start().DoAndReturn(func() error {
+				starts++
+				if starts == 2 {
+					close(restarted)
+				}
+				return nil
+			}).Times(2)
+			mockCommand.EXPECT().Wait().Return(errors.New("test error"))
+			stopped := make(chan struct{})
+			mockCommand.EXPECT().Wait().DoAndReturn(func() error {
+				<-stopped
+				return nil
+			})
+			mockCommand.EXPECT().Stop(gomock.Any()).DoAndReturn(func(syscall.Signal) error {
+				close(stopped)
+				return nil
+			})
+			mockCommand.EXPECT().ProcessState().Return(nil).AnyTimes()
+			mockCommand.EXPECT().Pid().Return(42).AnyTimes()
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- worker.Run(ctx)
+			}()
+
+			Eventually(restarted).Should(BeClosed())
+			Eventually(worker.IsRunning).Should(BeTrue())
+			cancel()
+			Eventually(errChan).Should(Receive(BeNil()))
+			Expect(worker.IsRunning()).To(BeFalse())
+		})
+	})
+
+	Describe("connectionPool", func() {
+		It("keeps a health check connection outside the pool", func() {
+			pool := newConnectionPool(1, slog.Default(), func() (*grpc.ClientConn, error) {
+				return grpc.NewClient("localhost:0", grpc.WithTransportCredentials(insecure.NewCredentials()))
+			})
+			DeferCleanup(pool.close)
+
+			conn, err := pool.fetchConn()
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(conn.Return)
+
+			health, err := pool.healthConn()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(health).NotTo(BeIdenticalTo(conn.Conn()))
+			Expect(pool.healthConn()).To(BeIdenticalTo(health))
+			Expect(pool.stats()).To(HaveField("InUse", 1))
+		})
+
+		It("does not wait for a free connection", func() {
+			pool := newConnectionPool(1, slog.Default(), func() (*grpc.ClientConn, error) {
+				return grpc.NewClient("localhost:0", grpc.WithTransportCredentials(insecure.NewCredentials()))
+			})
+			DeferCleanup(pool.close)
+
+			conn, err := pool.fetchConn()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = pool.fetchConn()
+			Expect(err).To(MatchError(ErrPoolExhausted))
+
+			conn.Return()
+			_, err = pool.fetchConn()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("readRSS", func() {
+		It("reads the resident memory of a process", func() {
+			rss, err := readRSS(os.Getpid(), false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rss).To(BeNumerically(">", 0))
+		})
+
+		It("includes the memory of child processes", func() {
+			child := exec.Command("sleep", "10")
+			Expect(child.Start()).To(Succeed())
+			DeferCleanup(func() {
+				_ = child.Process.Kill()
+				_ = child.Wait()
+			})
+
+			own, err := readRSS(os.Getpid(), false)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() int64 {
+				total, _ := readRSS(os.Getpid(), true)
+				return total
+			}).Should(BeNumerically(">", own))
+		})
+
+		It("returns an error for unknown processes", func() {
+			_, err := readRSS(-1, false)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("DefaultCommand", func() {
+		processGone := func(pid int) func() bool {
+			return func() bool {
+				stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+				// A killed process stays a zombie until its new parent reaps it.
+				return err != nil || strings.Contains(string(stat), ") Z ")
+			}
+		}
+
+		It("runs in the working directory", func() {
+			dir := GinkgoT().TempDir()
+			cmd := (&DefaultCommandExecutor{}).NewCommand("sh", "-c", "pwd > pwd.txt")
+			cmd.SetDir(dir)
+			Expect(cmd.Start()).To(Succeed())
+			Expect(cmd.Wait()).To(Succeed())
+
+			data, err := os.ReadFile(filepath.Join(dir, "pwd.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(string(data))).To(Equal(dir))
+		})
+
+		It("kills the whole process group", func() {
+			pidFile := filepath.Join(GinkgoT().TempDir(), "child.pid")
+			cmd := (&DefaultCommandExecutor{}).NewCommand("sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait")
+			Expect(cmd.Start()).To(Succeed())
+
+			var childPid int
+			Eventually(func() error {
+				data, err := os.ReadFile(pidFile)
+				if err == nil {
+					childPid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+				}
+				return err
+			}).Should(Succeed())
+
+			Expect(cmd.Kill()).To(Succeed())
+			Expect(cmd.Wait()).To(HaveOccurred())
+			Eventually(processGone(childPid)).Should(BeTrue())
+		})
+
+		It("reaps orphaned processes", func() {
+			if err := setSubreaper(); err != nil {
+				Skip(err.Error())
+			}
+
+			pidFile := filepath.Join(GinkgoT().TempDir(), "orphan.pid")
+			orphanParent := exec.Command("sh", "-c", "sleep 0.1 & echo $! > "+pidFile)
+			Expect(orphanParent.Run()).To(Succeed())
+
+			data, err := os.ReadFile(pidFile)
+			Expect(err).NotTo(HaveOccurred())
+			orphanPid, err := strconv.Atoi(strings.TrimSpace(string(data)))
 			Expect(err).NotTo(HaveOccurred())
-			Eventually(worker.IsRunning()).Should(BeFalse())
+
+			Eventually(func() bool {
+				reapOrphans(os.Getpid())
+				_, err := os.Stat(filepath.Join("/proc", strconv.Itoa(orphanPid)))
+				return os.IsNotExist(err)
+			}).Should(BeTrue())
+		})
+	})
+
+	Describe("restartPolicy", func() {
+		var cfg config.Restart
+
+		BeforeEach(func() {
+			cfg = config.Restart{
+				InitialDelay:      100 * time.Millisecond,
+				MaxDelay:          time.Second,
+				Multiplier:        2,
+				StableUptime:      time.Minute,
+				CrashLoopRestarts: 3,
+				CrashLoopWindow:   time.Minute,
+			}
+		})
+
+		It("grows the delay exponentially up to the max delay", func() {
+			policy := newRestartPolicy(cfg)
+			delays := make([]time.Duration, 0, 6)
+			for range 6 {
+				delays = append(delays, policy.nextDelay())
+			}
+			Expect(delays).To(Equal([]time.Duration{
+				100 * time.Millisecond,
+				200 * time.Millisecond,
+				400 * time.Millisecond,
+				800 * time.Millisecond,
+				time.Second,
+				time.Second,
+			}))
+		})
+
+		It("applies jitter around the delay", func() {
+			cfg.Jitter = 0.5
+			policy := newRestartPolicy(cfg)
+			Expect(policy.nextDelay()).To(BeNumerically("~", 100*time.Millisecond, 50*time.Millisecond))
+		})
+
+		It("starts over after reset", func() {
+			policy := newRestartPolicy(cfg)
+			policy.nextDelay()
+			policy.nextDelay()
+			policy.reset()
+			Expect(policy.nextDelay()).To(Equal(100 * time.Millisecond))
+		})
+
+		It("detects a crash loop when restarts happen inside the window", func() {
+			policy := newRestartPolicy(cfg)
+			now := time.Now()
+			Expect(policy.recordRestart(now)).To(BeFalse())
+			Expect(policy.recordRestart(now.Add(time.Second))).To(BeFalse())
+			Expect(policy.recordRestart(now.Add(2 * time.Second))).To(BeTrue())
+		})
+
+		It("forgets restarts outside the window", func() {
+			policy := newRestartPolicy(cfg)
+			now := time.Now()
+			Expect(policy.recordRestart(now)).To(BeFalse())
+			Expect(policy.recordRestart(now.Add(time.Second))).To(BeFalse())
+			Expect(policy.recordRestart(now.Add(2 * time.Minute))).To(BeFalse())
+		})
+
+		It("never reports a crash loop when detection is disabled", func() {
+			cfg.CrashLoopRestarts = 0
+			policy := newRestartPolicy(cfg)
+			now := time.Now()
+			for i := range 10 {
+				Expect(policy.recordRestart(now.Add(time.Duration(i) * time.Millisecond))).To(BeFalse())
+			}
+		})
+	})
+
+	Describe("ReportHealth", func() {
+		It("moves a running worker between ready and unhealthy", func() {
+			events := NewEventBus()
+			states := recordStates(events)
+			w := NewWorker("worker-1", 50051, 9090, "/metrics", 2, WithEvents(events))
+			w.status.State = StateBooting
+
+			w.ReportHealth(false, "connection refused")
+			Expect(w.Status().State).To(Equal(StateBooting))
+
+			w.ReportHealth(true, "serving")
+			w.ReportHealth(true, "serving")
+			w.ReportHealth(false, "not serving")
+			Expect(w.Status().Reason).To(Equal("not serving"))
+			w.ReportHealth(true, "serving")
+
+			Expect(states()).To(Equal([]State{StateReady, StateUnhealthy, StateReady}))
+		})
+
+		It("ignores workers that are not running", func() {
+			w := NewWorker("worker-1", 50051, 9090, "/metrics", 2)
+			w.status.State = StateDraining
+
+			w.ReportHealth(true, "serving")
+			Expect(w.Status().State).To(Equal(StateDraining))
+		})
+	})
+
+	Describe("DeleteMetrics", func() {
+		It("removes the series of a removed worker", func() {
+			series := func() int {
+				return testutil.CollectAndCount(workerState) + testutil.CollectAndCount(residentMemory) +
+					testutil.CollectAndCount(crashLooping) + testutil.CollectAndCount(workerSpare)
+			}
+			before := series()
+
+			w := NewWorker("worker-removed", 50051, 9090, "/metrics", 2)
+			RecordEvent(Event{Worker: w, From: StateStopping, Status: Status{State: StateExited, Spare: true}})
+			residentMemory.WithLabelValues(w.Name).Set(1)
+			crashLooping.WithLabelValues(w.Name).Set(1)
+			Expect(series()).To(Equal(before + len(States) + 3))
+
+			DeleteMetrics(w.Name)
+			Expect(series()).To(Equal(before))
+		})
+	})
+
+	Describe("SetSpare", func() {
+		It("publishes a change of the role without a state transition", func() {
+			events := NewEventBus()
+			var received []Event
+			events.Subscribe(func(e Event) { received = append(received, e) })
+			w := NewWorker("worker-1", 50051, 9090, "/metrics", 2, WithEvents(events))
+			w.status.State = StateReady
+
+			w.SetSpare(true)
+			w.SetSpare(true)
+			w.SetSpare(false)
+
+			Expect(received).To(HaveLen(2))
+			Expect(received[0].From).To(Equal(StateReady))
+			Expect(received[0].Status.State).To(Equal(StateReady))
+			Expect(received[0].Status.Spare).To(BeTrue())
+			Expect(received[1].Status.Spare).To(BeFalse())
+			Expect(w.Status().Spare).To(BeFalse())
+		})
+	})
+
+	Describe("EventBus", func() {
+		It("replays the last transition of every worker to new subscribers", func() {
+			events := NewEventBus()
+			w1 := NewWorker("worker-1", 50051, 9090, "/metrics", 2)
+			w2 := NewWorker("worker-2", 50052, 9091, "/metrics", 2)
+			events.Publish(Event{Worker: w1, From: StateBooting, Status: Status{State: StateReady}})
+			events.Publish(Event{Worker: w2, From: StateNew, Status: Status{State: StateStarting}})
+			events.Publish(Event{Worker: w2, From: StateStarting, Status: Status{State: StateBooting}})
+
+			received := map[string]State{}
+			events.Subscribe(func(e Event) {
+				received[e.Worker.String()] = e.Status.State
+			})
+			Expect(received).To(Equal(map[string]State{"worker-1": StateReady, "worker-2": StateBooting}))
+
+			events.Publish(Event{Worker: w2, From: StateBooting, Status: Status{State: StateReady}})
+			Expect(received).To(HaveKeyWithValue("worker-2", StateReady))
+		})
+	})
+
+	Describe("outputLogger", func() {
+		var (
+			buf     *bytes.Buffer
+			records func() []map[string]any
+		)
+
+		BeforeEach(func() {
+			buf = &bytes.Buffer{}
+			records = func() []map[string]any {
+				var result []map[string]any
+				for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+					if line == "" {
+						continue
+					}
+					var record map[string]any
+					Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+					result = append(result, record)
+				}
+				return result
+			}
+		})
+
+		newOutput := func(maxLine int) *outputLogger {
+			logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})).With(slog.String("worker", "worker-1"))
+			return newOutputLogger(logger, "stdout", maxLine)
+		}
+
+		It("emits lines split across writes with the worker attribute", func() {
+			output := newOutput(1024)
+			fmt.Fprint(output, "Booting ")
+			fmt.Fprint(output, "Puma\r\n\nListening")
+			Expect(records()).To(HaveLen(1))
+
+			output.flush()
+			Expect(records()).To(HaveExactElements(
+				And(HaveKeyWithValue("msg", "Booting Puma"), HaveKeyWithValue("worker", "worker-1"), HaveKeyWithValue("stream", "stdout"), HaveKeyWithValue("level", "INFO")),
+				HaveKeyWithValue("msg", "Listening"),
+			))
+		})
+
+		It("merges JSON lines as fields", func() {
+			output := newOutput(1024)
+			fmt.Fprintln(output, `{"time":"2025-05-01T00:00:00Z","level":"warn","message":"Slow request","duration":1.5,"worker":"puma","payload":{"id":1}}`)
+
+			Expect(records()).To(HaveExactElements(And(
+				HaveKeyWithValue("msg", "Slow request"),
+				HaveKeyWithValue("level", "WARN"),
+				HaveKeyWithValue("duration", 1.5),
+				HaveKeyWithValue("payload", HaveKeyWithValue("id", 1.0)),
+				HaveKeyWithValue("worker", "worker-1"),
+			)))
+		})
+
+		It("truncates long lines", func() {
+			output := newOutput(8)
+			fmt.Fprintln(output, `{"message":"too long to parse"}`)
+			fmt.Fprintln(output, "short")
+
+			Expect(records()).To(HaveExactElements(
+				And(HaveKeyWithValue("msg", `{"messag`), HaveKeyWithValue("truncated", true)),
+				And(HaveKeyWithValue("msg", "short"), Not(HaveKey("truncated"))),
+			))
+		})
+	})
+
+	DescribeTable("classifyExit",
+		func(code int, signal, killReason string, oomKills int64, oomKnown bool, expected ExitReason) {
+			Expect(classifyExit(code, signal, killReason, oomKills, oomKnown)).To(Equal(expected))
+		},
+		Entry("clean exit", 0, "", "", int64(0), true, ExitReasonClean),
+		Entry("non-zero exit code", 1, "", "", int64(0), true, ExitReasonCode),
+		Entry("signal", -1, syscall.SIGSEGV.String(), "", int64(0), true, ExitReasonSignal),
+		Entry("SIGKILL with an OOM kill in the cgroup", -1, syscall.SIGKILL.String(), "", int64(1), true, ExitReasonOOM),
+		Entry("SIGKILL without OOM kills in the cgroup", -1, syscall.SIGKILL.String(), "", int64(0), true, ExitReasonSignal),
+		Entry("SIGKILL without the OOM kill counter", -1, syscall.SIGKILL.String(), "", int64(0), false, ExitReasonOOM),
+		Entry("OOM kill of another process in the cgroup", 1, "", "", int64(1), true, ExitReasonCode),
+		Entry("other signal with an OOM kill in the cgroup", -1, syscall.SIGSEGV.String(), "", int64(1), true, ExitReasonSignal),
+		Entry("killed by the relay", -1, syscall.SIGKILL.String(), RestartReasonBootTimeout, int64(1), true, ExitReasonKilled),
+	)
+
+	Describe("outputTail", func() {
+		It("keeps the last lines of both streams", func() {
+			tail := newOutputTail(3)
+			stdout, stderr := tail.writer("stdout"), tail.writer("stderr")
+			fmt.Fprint(stdout, "one\ntw")
+			fmt.Fprint(stderr, "three\r\n\n")
+			fmt.Fprint(stdout, "o\n"+strings.Repeat("a", maxTailLine+10))
+			stdout.flush()
+
+			Expect(tail.snapshot()).To(Equal([]OutputLine{
+				{Stream: "stderr", Text: "three"},
+				{Stream: "stdout", Text: "two"},
+				{Stream: "stdout", Text: strings.Repeat("a", maxTailLine)},
+			}))
+		})
+	})
+
+	Describe("exitStatus", func() {
+		It("reports the exit code of a process", func() {
+			code, sig := exitStatus(exec.Command("sh", "-c", "exit 3").Run())
+			Expect(code).To(Equal(3))
+			Expect(sig).To(BeEmpty())
+		})
+
+		It("reports the signal that killed a process", func() {
+			code, sig := exitStatus(exec.Command("sh", "-c", "kill -TERM $$").Run())
+			Expect(code).To(Equal(-1))
+			Expect(sig).To(Equal(syscall.SIGTERM.String()))
 		})
 	})
 })
+
+// recordStates collects the states entered by workers publishing on the bus.
+func recordStates(events *EventBus) func() []State {
+	var (
+		mu     sync.Mutex
+		states []State
+	)
+	events.Subscribe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, e.Status.State)
+	})
+
+	return func() []State {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(states)
+	}
+}